@@ -0,0 +1,87 @@
+package citation
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func writeBibTeX(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for i, e := range entries {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		bw.WriteString("@book{" + e.Key + ",\n")
+		field := func(name, value string) {
+			if value != "" {
+				bw.WriteString("  " + name + " = {" + value + "},\n")
+			}
+		}
+
+		var authors []string
+		for _, name := range Authors(e.Book) {
+			author := escapeBibTeX(name.Family)
+			if name.Given != "" {
+				author += ", " + escapeBibTeX(name.Given)
+			}
+			authors = append(authors, author)
+		}
+		field("author", strings.Join(authors, " and "))
+		field("title", bibTeXTitle(e.Book.Title))
+		field("publisher", escapeBibTeX(Publisher(e.Book)))
+		field("year", Year(e.Book))
+		field("isbn", escapeBibTeX(e.Book.ISBN))
+		bw.WriteString("}\n")
+	}
+	return bw.Flush()
+}
+
+// bibTeXTitle escapes title and braces the words with capitals after their
+// first letter, such as acronyms, so styles that lower-case titles keep them.
+func bibTeXTitle(title string) string {
+	words := strings.Fields(title)
+	for i, word := range words {
+		words[i] = escapeBibTeX(word)
+		if first := strings.IndexFunc(word, unicode.IsLetter); first >= 0 {
+			_, size := utf8.DecodeRuneInString(word[first:])
+			if strings.IndexFunc(word[first+size:], unicode.IsUpper) >= 0 {
+				words[i] = "{" + words[i] + "}"
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// escapeBibTeX writes the characters TeX treats specially, and accented
+// Latin letters, as commands. Braces become commands too, as BibTeX counts
+// even escaped ones when finding the end of a field.
+func escapeBibTeX(s string) string {
+	var b strings.Builder
+	for _, r := range flatten(s) {
+		switch r {
+		case '\\':
+			b.WriteString(`\textbackslash{}`)
+		case '{':
+			b.WriteString(`\textbraceleft{}`)
+		case '}':
+			b.WriteString(`\textbraceright{}`)
+		case '~':
+			b.WriteString(`\textasciitilde{}`)
+		case '^':
+			b.WriteString(`\textasciicircum{}`)
+		case '#', '$', '%', '&', '_':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		default:
+			if c, ok := latin[r]; ok {
+				b.WriteString(c.latex)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
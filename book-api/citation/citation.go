@@ -0,0 +1,202 @@
+// Package citation formats books as BibTeX, RIS and CSL-JSON citations.
+package citation
+
+import (
+	"book-api/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Style is a citation format.
+type Style struct {
+	Name        string
+	ContentType string
+	Write       func(w io.Writer, entries []Entry) error
+}
+
+var (
+	BibTeX  = &Style{Name: "bibtex", ContentType: "application/x-bibtex; charset=utf-8", Write: writeBibTeX}
+	RIS     = &Style{Name: "ris", ContentType: "application/x-research-info-systems; charset=utf-8", Write: writeRIS}
+	CSLJSON = &Style{Name: "csl-json", ContentType: "application/vnd.citationstyles.csl+json", Write: writeCSLJSON}
+
+	Styles = []*Style{BibTeX, RIS, CSLJSON}
+)
+
+// Lookup returns the style called name.
+func Lookup(name string) (*Style, bool) {
+	for _, s := range Styles {
+		if strings.EqualFold(s.Name, name) {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// Entry is a book with the key it is cited by.
+type Entry struct {
+	Key  string
+	Book *models.Book
+}
+
+// Entries keys books for an export.
+func Entries(books []*models.Book) []Entry {
+	entries := make([]Entry, len(books))
+	for i, book := range books {
+		entries[i] = Entry{Key: Key(book), Book: book}
+	}
+	return entries
+}
+
+var stopWords = map[string]bool{"a": true, "an": true, "the": true, "of": true, "on": true, "in": true, "and": true, "to": true}
+
+// Key is the citation key of book: the family name of its first author, its
+// year and the first significant word of its title, then a hash of its ISBN,
+// or of its ID when it has none, as in tolkien2002hobbit-3c2f. The hash tells
+// apart books that agree on the rest, such as editions, and depends only on
+// the book, so a book has the same key whatever it is cited with. A book
+// with no author, year or title is keyed by its ISBN or ID alone.
+func Key(book *models.Book) string {
+	var key string
+	if authors := Authors(book); len(authors) > 0 {
+		key = keyPart(authors[0].Family)
+	}
+	key += Year(book)
+	for _, word := range strings.Fields(book.Title) {
+		if word = keyPart(word); word != "" && !stopWords[word] {
+			key += word
+			break
+		}
+	}
+	id := firstNonEmpty(keyPart(book.ISBN), book.BookID)
+	if key == "" {
+		return "book" + keyPart(id)
+	}
+	sum := sha256.Sum256([]byte(id))
+	return key + "-" + hex.EncodeToString(sum[:2])
+}
+
+// keyPart folds s to lower-case ASCII letters and digits.
+func keyPart(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case 'a' <= r && r <= 'z', '0' <= r && r <= '9':
+			b.WriteRune(r)
+		default:
+			if c, ok := latin[r]; ok {
+				b.WriteString(strings.ToLower(c.ascii))
+			}
+		}
+	}
+	return b.String()
+}
+
+// Name is a person's name split as citation formats want it. A name in one
+// word, such as that of an organisation, is all Family.
+type Name struct {
+	Family, Given string
+}
+
+// Authors are the authors of book, which the importer joins with "; " in
+// authorId. A name is split at a comma, as in "Tolkien, J. R. R.", or else
+// before its last word. IDs are left out, as they name no one.
+func Authors(book *models.Book) []Name {
+	var names []Name
+	for _, author := range strings.Split(book.AuthorID, ";") {
+		author = flatten(author)
+		if author == "" || isID(author) {
+			continue
+		}
+		if family, given, ok := strings.Cut(author, ","); ok {
+			names = append(names, Name{strings.TrimSpace(family), strings.TrimSpace(given)})
+		} else if i := strings.LastIndex(author, " "); i > 0 {
+			names = append(names, Name{author[i+1:], author[:i]})
+		} else {
+			names = append(names, Name{Family: author})
+		}
+	}
+	return names
+}
+
+// Publisher is the name of the publisher of book, or "" when publisherId
+// holds an ID rather than a name.
+func Publisher(book *models.Book) string {
+	if name := flatten(book.PublisherID); !isID(name) {
+		return name
+	}
+	return ""
+}
+
+// isID reports whether s is a UUID, as authorId and publisherId hold for
+// books created through the API rather than imported with names.
+func isID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+var datePattern = regexp.MustCompile(`^(\d{4})(?:-(\d{2})(?:-(\d{2}))?)?`)
+
+// Year is the year book was published, or "".
+func Year(book *models.Book) string {
+	if parts := dateParts(book); len(parts) > 0 {
+		return strconv.Itoa(parts[0])
+	}
+	return ""
+}
+
+// dateParts are the year, month and day of the publication date, as far as
+// it gives them.
+func dateParts(book *models.Book) []int {
+	m := datePattern.FindStringSubmatch(strings.TrimSpace(book.PublicationDate))
+	if m == nil {
+		return nil
+	}
+	var parts []int
+	for _, s := range m[1:] {
+		if s == "" {
+			break
+		}
+		n, _ := strconv.Atoi(s)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// flatten puts s on one line with single spaces.
+func flatten(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// latin are the letters beyond ASCII that keys fold and BibTeX writes as
+// LaTeX commands.
+var latin = map[rune]struct{ latex, ascii string }{
+	'à': {"{\\`a}", "a"}, 'á': {"{\\'a}", "a"}, 'â': {"{\\^a}", "a"}, 'ä': {"{\\\"a}", "a"}, 'ã': {"{\\~a}", "a"}, 'å': {"{\\aa}", "a"},
+	'è': {"{\\`e}", "e"}, 'é': {"{\\'e}", "e"}, 'ê': {"{\\^e}", "e"}, 'ë': {"{\\\"e}", "e"},
+	'ì': {"{\\`i}", "i"}, 'í': {"{\\'i}", "i"}, 'î': {"{\\^i}", "i"}, 'ï': {"{\\\"i}", "i"},
+	'ò': {"{\\`o}", "o"}, 'ó': {"{\\'o}", "o"}, 'ô': {"{\\^o}", "o"}, 'ö': {"{\\\"o}", "o"}, 'õ': {"{\\~o}", "o"}, 'ø': {"{\\o}", "o"},
+	'ù': {"{\\`u}", "u"}, 'ú': {"{\\'u}", "u"}, 'û': {"{\\^u}", "u"}, 'ü': {"{\\\"u}", "u"},
+	'ý': {"{\\'y}", "y"}, 'ÿ': {"{\\\"y}", "y"}, 'ñ': {"{\\~n}", "n"}, 'ç': {"{\\c{c}}", "c"},
+	'À': {"{\\`A}", "A"}, 'Á': {"{\\'A}", "A"}, 'Â': {"{\\^A}", "A"}, 'Ä': {"{\\\"A}", "A"}, 'Ã': {"{\\~A}", "A"}, 'Å': {"{\\AA}", "A"},
+	'È': {"{\\`E}", "E"}, 'É': {"{\\'E}", "E"}, 'Ê': {"{\\^E}", "E"}, 'Ë': {"{\\\"E}", "E"},
+	'Ì': {"{\\`I}", "I"}, 'Í': {"{\\'I}", "I"}, 'Î': {"{\\^I}", "I"}, 'Ï': {"{\\\"I}", "I"},
+	'Ò': {"{\\`O}", "O"}, 'Ó': {"{\\'O}", "O"}, 'Ô': {"{\\^O}", "O"}, 'Ö': {"{\\\"O}", "O"}, 'Õ': {"{\\~O}", "O"}, 'Ø': {"{\\O}", "O"},
+	'Ù': {"{\\`U}", "U"}, 'Ú': {"{\\'U}", "U"}, 'Û': {"{\\^U}", "U"}, 'Ü': {"{\\\"U}", "U"},
+	'Ý': {"{\\'Y}", "Y"}, 'Ñ': {"{\\~N}", "N"}, 'Ç': {"{\\c{C}}", "C"},
+	'ß': {"{\\ss}", "ss"}, 'æ': {"{\\ae}", "ae"}, 'Æ': {"{\\AE}", "AE"}, 'œ': {"{\\oe}", "oe"}, 'Œ': {"{\\OE}", "OE"},
+	'ł': {"{\\l}", "l"}, 'Ł': {"{\\L}", "L"},
+}
@@ -0,0 +1,161 @@
+package citation
+
+import (
+	"book-api/models"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var hobbit = &models.Book{
+	BookID:          "b1",
+	Title:           "The Hobbit: Or There and Back Again",
+	AuthorID:        "J. R. R. Tolkien",
+	PublisherID:     "Houghton Mifflin",
+	PublicationDate: "2002-09-15",
+	ISBN:            "9780618260300",
+}
+
+func write(t *testing.T, style *Style, books ...*models.Book) string {
+	var buf bytes.Buffer
+	require.NoError(t, style.Write(&buf, Entries(books)))
+	return buf.String()
+}
+
+func TestKey(t *testing.T) {
+	for _, tc := range []struct {
+		book *models.Book
+		key  string
+	}{
+		{hobbit, "tolkien2002hobbit-fada"},
+		{&models.Book{Title: "A Tale of Two Cities", AuthorID: "Dickens, Charles", PublicationDate: "1859"}, "dickens1859tale-e3b0"},
+		{&models.Book{Title: "Ærø: Øer i Østersøen", AuthorID: "Søren Müller-Brønnum; Ann Lee"}, "mullerbronnumaero-e3b0"},
+		{&models.Book{Title: "1984", AuthorID: "George Orwell"}, "orwell1984-e3b0"},
+		{&models.Book{Title: "¿?", ISBN: "978-0-14-143958-0"}, "book9780141439580"},
+		{&models.Book{BookID: "0c4f-AB"}, "book0c4fab"},
+	} {
+		assert.Equal(t, tc.key, Key(tc.book), tc.book.Title)
+	}
+}
+
+func TestKeyIsStable(t *testing.T) {
+	// Two editions that agree on author, year and title.
+	chilton := &models.Book{BookID: "x", Title: "Dune", AuthorID: "Frank Herbert", PublicationDate: "1965", ISBN: "9780441172719"}
+	ace := &models.Book{BookID: "y", Title: "Dune", AuthorID: "Frank Herbert", PublicationDate: "1965", ISBN: "9780441013593"}
+
+	alone := map[string]string{}
+	for _, book := range []*models.Book{chilton, ace, hobbit} {
+		entries := Entries([]*models.Book{book})
+		alone[book.BookID] = entries[0].Key
+	}
+	assert.NotEqual(t, alone["x"], alone["y"])
+
+	for _, books := range [][]*models.Book{{chilton, hobbit, ace}, {ace, chilton}} {
+		for _, e := range Entries(books) {
+			assert.Equal(t, alone[e.Book.BookID], e.Key)
+		}
+	}
+
+	// The ISBN, not the ID, keys a book, so a re-imported book keeps its key.
+	copied := *chilton
+	copied.BookID = "z"
+	assert.Equal(t, alone["x"], Key(&copied))
+	copied.ISBN = "978-0-441-17271-9"
+	assert.Equal(t, alone["x"], Key(&copied))
+}
+
+func TestIDsAreNotNames(t *testing.T) {
+	// As in data/books.json, where books refer to authors and publishers by ID.
+	gatsby := &models.Book{
+		BookID:          "3f67c822-99a0-4ed4-ad8a-c9d8651d4a81",
+		AuthorID:        "e0d91f68-a183-477d-8aa4-1f44ccc78a70",
+		PublisherID:     "2f7b19e9-b268-4440-a15b-bed8177ed607",
+		Title:           "The Great Gatsby - Updated Edition",
+		PublicationDate: "1925-04-10",
+		ISBN:            "9780743273565",
+	}
+	assert.Empty(t, Authors(gatsby))
+	assert.Empty(t, Publisher(gatsby))
+	key := Key(gatsby)
+	assert.Regexp(t, `^1925great-[0-9a-f]{4}$`, key)
+
+	for _, style := range Styles {
+		out := write(t, style, gatsby)
+		assert.NotContains(t, out, "e0d91f68", style.Name)
+		assert.NotContains(t, out, "2f7b19e9", style.Name)
+		assert.Contains(t, out, key, style.Name)
+		assert.Contains(t, out, "9780743273565", style.Name)
+	}
+
+	mixed := &models.Book{AuthorID: "Ann Lee; e0d91f68-a183-477d-8aa4-1f44ccc78a70", PublisherID: "Tor"}
+	assert.Equal(t, []Name{{Family: "Lee", Given: "Ann"}}, Authors(mixed))
+	assert.Equal(t, "Tor", Publisher(mixed))
+}
+
+func TestBibTeX(t *testing.T) {
+	assert.Equal(t, `@book{tolkien2002hobbit-fada,
+  author = {Tolkien, J. R. R.},
+  title = {The Hobbit: Or There and Back Again},
+  publisher = {Houghton Mifflin},
+  year = {2002},
+  isbn = {9780618260300},
+}
+`, write(t, BibTeX, hobbit))
+
+	tricky := &models.Book{
+		Title:       "R&D at NASA: 100% {Braced} C_x \\ ~ ^ #1 $5",
+		AuthorID:    "Brontë, Charlotte; Anonymous",
+		PublisherID: "Smith & Sons",
+	}
+	out := write(t, BibTeX, tricky, hobbit)
+	assert.Contains(t, out, `author = {Bront{\"e}, Charlotte and Anonymous},`)
+	assert.Contains(t, out, `title = {{R\&D} at {NASA:} 100\% \textbraceleft{}Braced\textbraceright{} C\_x \textbackslash{} \textasciitilde{} \textasciicircum{} \#1 \$5},`)
+	assert.Contains(t, out, "@book{bronterd-e3b0,\n")
+	assert.Contains(t, out, "publisher = {Smith \\& Sons},\n}\n\n@book{tolkien2002hobbit-fada,")
+
+	assert.Equal(t, `{McDonald's} Caf{\'e} {\ss}`, bibTeXTitle("McDonald's  Café\nß"))
+}
+
+func TestRIS(t *testing.T) {
+	assert.Equal(t, "TY  - BOOK\r\n"+
+		"ID  - tolkien2002hobbit-fada\r\n"+
+		"AU  - Tolkien, J. R. R.\r\n"+
+		"TI  - The Hobbit: Or There and Back Again\r\n"+
+		"PB  - Houghton Mifflin\r\n"+
+		"PY  - 2002\r\n"+
+		"DA  - 2002/09/15/\r\n"+
+		"SN  - 9780618260300\r\n"+
+		"ER  - \r\n", write(t, RIS, hobbit))
+
+	out := write(t, RIS, &models.Book{Title: "Line\nbreaks", AuthorID: "Plato", PublicationDate: "1990-05"}, hobbit)
+	assert.Contains(t, out, "AU  - Plato\r\nTI  - Line breaks\r\nPY  - 1990\r\nDA  - 1990/05//\r\nER  - \r\n\r\nTY  - BOOK\r\n")
+}
+
+func TestCSLJSON(t *testing.T) {
+	var items []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(write(t, CSLJSON, hobbit, &models.Book{BookID: "2", Title: "Untitled & <Undated>"})), &items))
+	require.Len(t, items, 2)
+	assert.Equal(t, map[string]any{
+		"id":        "tolkien2002hobbit-fada",
+		"type":      "book",
+		"title":     "The Hobbit: Or There and Back Again",
+		"author":    []any{map[string]any{"family": "Tolkien", "given": "J. R. R."}},
+		"publisher": "Houghton Mifflin",
+		"issued":    map[string]any{"date-parts": []any{[]any{2002.0, 9.0, 15.0}}},
+		"ISBN":      "9780618260300",
+	}, items[0])
+	assert.Equal(t, map[string]any{"id": "untitled-d473", "type": "book", "title": "Untitled & <Undated>"}, items[1])
+
+	assert.Equal(t, "[]\n", write(t, CSLJSON))
+}
+
+func TestLookup(t *testing.T) {
+	style, ok := Lookup("CSL-JSON")
+	assert.True(t, ok)
+	assert.Same(t, CSLJSON, style)
+	_, ok = Lookup("mla")
+	assert.False(t, ok)
+}
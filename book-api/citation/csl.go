@@ -0,0 +1,53 @@
+package citation
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// cslItem is a CSL-JSON item of type book.
+type cslItem struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Title     string    `json:"title,omitempty"`
+	Author    []cslName `json:"author,omitempty"`
+	Publisher string    `json:"publisher,omitempty"`
+	Issued    *cslDate  `json:"issued,omitempty"`
+	ISBN      string    `json:"ISBN,omitempty"`
+}
+
+type cslName struct {
+	Family string `json:"family"`
+	Given  string `json:"given,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+// writeCSLJSON writes entries as a CSL-JSON array, which citation processors
+// expect even for a single item.
+func writeCSLJSON(w io.Writer, entries []Entry) error {
+	items := make([]cslItem, 0, len(entries))
+	for _, e := range entries {
+		item := cslItem{
+			ID:        e.Key,
+			Type:      "book",
+			Title:     flatten(e.Book.Title),
+			Publisher: Publisher(e.Book),
+			ISBN:      flatten(e.Book.ISBN),
+		}
+		for _, name := range Authors(e.Book) {
+			item.Author = append(item.Author, cslName(name))
+		}
+		if parts := dateParts(e.Book); len(parts) > 0 {
+			item.Issued = &cslDate{DateParts: [][]int{parts}}
+		}
+		items = append(items, item)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(items)
+}
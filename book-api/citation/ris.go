@@ -0,0 +1,42 @@
+package citation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// writeRIS writes entries as RIS records, whose lines end in CRLF.
+func writeRIS(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+	for i, e := range entries {
+		if i > 0 {
+			bw.WriteString("\r\n")
+		}
+		tag := func(name, value string) {
+			if value = flatten(value); value != "" {
+				bw.WriteString(name + "  - " + value + "\r\n")
+			}
+		}
+
+		tag("TY", "BOOK")
+		tag("ID", e.Key)
+		for _, name := range Authors(e.Book) {
+			tag("AU", strings.TrimSuffix(name.Family+", "+name.Given, ", "))
+		}
+		tag("TI", e.Book.Title)
+		tag("PB", Publisher(e.Book))
+		tag("PY", Year(e.Book))
+		if parts := dateParts(e.Book); len(parts) > 1 {
+			date := fmt.Sprintf("%04d/%02d/", parts[0], parts[1])
+			if len(parts) > 2 {
+				date += fmt.Sprintf("%02d", parts[2])
+			}
+			tag("DA", date+"/")
+		}
+		tag("SN", e.Book.ISBN)
+		bw.WriteString("ER  - \r\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"book-api/importer"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunImportReportsCSVErrors(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "books.csv")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	err := runImport([]string{"-dry-run", write("foo,bar\n1,2\n")})
+	assert.ErrorIs(t, err, importer.ErrNoColumns)
+
+	err = runImport([]string{"-dry-run", write("title\n\"unterminated\n")})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid csv:")
+	assert.NotContains(t, err.Error(), "no records")
+
+	err = runImport([]string{"-dry-run", write("title\n")})
+	assert.EqualError(t, err, "the file has no records")
+
+	err = runImport([]string{"-dry-run", "-profile", "goodreads", write("Title,ISBN13\nDune,9780441172719\n")})
+	assert.EqualError(t, err, `profile "goodreads": the export has no price column; set default.price`)
+	err = runImport([]string{"-default", "price"})
+	assert.ErrorContains(t, err, "expected field=value")
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"book-api/storage"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ReloadStatusProvider is implemented by stores that watch their data file
+// for external edits.
+type ReloadStatusProvider interface {
+	ReloadStatus() storage.ReloadStatus
+}
+
+// IntegrityStatusProvider is implemented by stores that checksum their data
+// file and recover from corruption.
+type IntegrityStatusProvider interface {
+	IntegrityStatus() storage.IntegrityStatus
+}
+
+// BackupManager is implemented by stores that keep backups of their data file.
+type BackupManager interface {
+	Backups() ([]storage.BackupInfo, error)
+	RestoreBackup(name string) error
+}
+
+type AdminHandler struct {
+	reload    ReloadStatusProvider
+	backups   BackupManager
+	integrity IntegrityStatusProvider
+}
+
+// NewAdminHandler accepts nil for features the storage driver lacks.
+func NewAdminHandler(reload ReloadStatusProvider, backups BackupManager, integrity IntegrityStatusProvider) *AdminHandler {
+	return &AdminHandler{reload: reload, backups: backups, integrity: integrity}
+}
+
+func (h *AdminHandler) GetReloadStatus(w http.ResponseWriter, r *http.Request) {
+	if h.reload == nil {
+		respondWithError(w, http.StatusNotFound, "Hot reload is not available for this storage driver")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, h.reload.ReloadStatus())
+}
+
+// GetIntegrityStatus answers 503 while the store is degraded so that health
+// checks notice, but still includes the status body.
+func (h *AdminHandler) GetIntegrityStatus(w http.ResponseWriter, r *http.Request) {
+	if h.integrity == nil {
+		respondWithError(w, http.StatusNotFound, "Integrity checks are not available for this storage driver")
+		return
+	}
+
+	status := h.integrity.IntegrityStatus()
+	code := http.StatusOK
+	if status.Degraded {
+		code = http.StatusServiceUnavailable
+	}
+	respondWithJSON(w, code, status)
+}
+
+func (h *AdminHandler) ListBackups(w http.ResponseWriter, r *http.Request) {
+	if h.backups == nil {
+		respondWithError(w, http.StatusNotFound, storage.ErrBackupsDisabled.Error())
+		return
+	}
+
+	backups, err := h.backups.Backups()
+	if errors.Is(err, storage.ErrBackupsDisabled) {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if backups == nil {
+		backups = []storage.BackupInfo{}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"data":  backups,
+		"total": len(backups),
+	})
+}
+
+func (h *AdminHandler) RestoreBackup(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if h.backups == nil {
+		respondWithError(w, http.StatusNotFound, storage.ErrBackupsDisabled.Error())
+		return
+	}
+
+	err := h.backups.RestoreBackup(name)
+	switch {
+	case errors.Is(err, storage.ErrBackupNotFound), errors.Is(err, storage.ErrBackupsDisabled):
+		respondWithError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, storage.ErrInvalidCatalog):
+		respondWithError(w, http.StatusUnprocessableEntity, err.Error())
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+	default:
+		respondWithJSON(w, http.StatusOK, map[string]string{"restored": name})
+	}
+}
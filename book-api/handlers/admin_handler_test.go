@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"book-api/models"
+	"book-api/repository"
+	"book-api/storage"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticReloadStatus storage.ReloadStatus
+
+func (s staticReloadStatus) ReloadStatus() storage.ReloadStatus {
+	return storage.ReloadStatus(s)
+}
+
+func TestAdminHandler_GetReloadStatus(t *testing.T) {
+	handler := NewAdminHandler(staticReloadStatus{Reloads: 2, Rejections: 1, LastError: "invalid catalog"}, nil, nil)
+
+	rr := httptest.NewRecorder()
+	handler.GetReloadStatus(rr, httptest.NewRequest("GET", "/admin/reload-status", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var status storage.ReloadStatus
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.Equal(t, 2, status.Reloads)
+	assert.Equal(t, "invalid catalog", status.LastError)
+}
+
+func TestAdminHandler_GetReloadStatusUnavailable(t *testing.T) {
+	handler := NewAdminHandler(nil, nil, nil)
+
+	rr := httptest.NewRecorder()
+	handler.GetReloadStatus(rr, httptest.NewRequest("GET", "/admin/reload-status", nil))
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func newBackupTestStore(t *testing.T) (*storage.FileStore, *storage.Backups) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+
+	store, err := storage.NewFileStore(path, storage.JSONCodec{})
+	require.NoError(t, err)
+	backups, err := storage.NewBackups(filepath.Join(dir, "backups"), path, 5, 0)
+	require.NoError(t, err)
+	store.EnableBackups(backups)
+	return store, backups
+}
+
+func TestAdminHandler_ListAndRestoreBackups(t *testing.T) {
+	store, _ := newBackupTestStore(t)
+	original := models.NewBook()
+	original.Title = "Before the bad edit"
+	original.AuthorID, original.PublisherID, original.ISBN = "a", "p", "111"
+	original.Pages, original.Price = 10, 1
+	require.NoError(t, store.WriteAll([]*models.Book{original}))
+	require.NoError(t, store.WriteAll(nil))
+
+	handler := NewAdminHandler(store, store, store)
+	router := mux.NewRouter()
+	router.HandleFunc("/admin/backups", handler.ListBackups).Methods("GET")
+	router.HandleFunc("/admin/backups/{name}/restore", handler.RestoreBackup).Methods("POST")
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/backups", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var listing struct {
+		Data  []storage.BackupInfo `json:"data"`
+		Total int                  `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listing))
+	// The empty initial catalog and the one with the book, newest first.
+	require.Equal(t, 2, listing.Total)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/backups/"+listing.Data[0].Name+"/restore", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Before the bad edit", books[0].Title)
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest("POST", "/admin/backups/books-missing.json/restore", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestAdminHandler_GetIntegrityStatus(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	require.NoError(t, os.WriteFile(path, []byte("corrupt"), 0644))
+
+	store, err := storage.NewFileStore(path, storage.JSONCodec{})
+	require.NoError(t, err)
+	repo := repository.NewBookRepository(store)
+	handler := NewAdminHandler(store, store, store)
+
+	// The corrupt file is found on first use; with no backup the store degrades.
+	books, err := repo.GetAllBooks(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, books)
+
+	rr := httptest.NewRecorder()
+	handler.GetIntegrityStatus(rr, httptest.NewRequest("GET", "/admin/integrity", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var status storage.IntegrityStatus
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.True(t, status.Degraded)
+	assert.Equal(t, 1, status.Corruptions)
+
+	bookHandler := NewBookHandler(repo)
+	body := `{"title":"T","authorId":"a","publisherId":"p","isbn":"1","pages":1,"price":1}`
+	rr = httptest.NewRecorder()
+	bookHandler.CreateBook(rr, httptest.NewRequest("POST", "/books", strings.NewReader(body)))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	rr = httptest.NewRecorder()
+	NewAdminHandler(nil, nil, nil).GetIntegrityStatus(rr, httptest.NewRequest("GET", "/admin/integrity", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -1,49 +1,119 @@
 package handlers
 
 import (
+	"book-api/importer"
 	"book-api/models"
 	"book-api/repository"
+	"book-api/storage"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http" //core HTTP utilities.
-	"strconv"  //string to number conversion.
 
 	"github.com/gorilla/mux"
 )
 
 type BookHandler struct {
 	repo repository.BookRepository
+	// RequireIfMatch rejects PUT, PATCH and DELETE without an If-Match header with
+	// 428 Precondition Required.
+	RequireIfMatch bool
+	// MaxPageSize caps the limit of GET /books; 0 means DefaultMaxPageSize.
+	MaxPageSize int
+	// ImportProfiles are custom profiles for POST /books/import, by name. They
+	// shadow built-in profiles of the same name.
+	ImportProfiles map[string]importer.Profile
 }
 
 func NewBookHandler(repo repository.BookRepository) *BookHandler {
 	return &BookHandler{repo: repo} //Constructor function to initialize and return a BookHandler instance.
 }
 
+// GetBooks lists the catalog, filtered by the parameters of parseBookFilter,
+// ordered by sort, paginated, shaped by fields and exclude and encoded in the
+// negotiated format. Invalid and unknown parameters are rejected with 400.
 func (h *BookHandler) GetBooks(w http.ResponseWriter, r *http.Request) {
-	limit, offset := getPaginationParams(r)
-
-	books, err := h.repo.GetAllBooks()
+	if err := checkParams(r.URL.Query(), bookFilterParams, listParams); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	format, err := negotiateFormat(w, r)
+	if err != nil {
+		respondWithError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	page, err := getPaginationParams(r, defaultPageSize, maxPageSize(h.MaxPageSize))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := parseBookFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	keys, err := parseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(keys) == 0 {
+		keys = defaultSort
+	}
+	fields, err := parseFieldSet(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	start := offset
-	if start > len(books) {
-		start = len(books)
+	// Read before the books, so a write in between can only make the
+	// validator older than the response and never newer.
+	modified, err := h.repo.CatalogModified(r.Context())
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	books, err := h.repo.GetAllBooks(r.Context())
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	if notModified(w, r, format.etag(catalogETag(books)), modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
-	end := start + limit
-	if end > len(books) {
-		end = len(books)
+
+	books = filterBooks(books, filter)
+	sortBooks(books, keys)
+
+	data, next, prev, err := paginate(books, keys, page, queryFingerprint(r.URL.Query()))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	setLinkHeader(w, r, next, prev)
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"data":   books[start:end],
-		"total":  len(books),
-		"limit":  limit,
-		"offset": offset,
+	respondWithBooks(w, http.StatusOK, format, bookList{
+		books:  data,
+		fields: fields,
+		page:   &pageInfo{total: len(books), limit: page.limit, offset: page.offset, next: next, prev: prev},
 	})
 }
 
+// filterBooks returns the books matching filter.
+func filterBooks(books []*models.Book, filter repository.BookFilter) []*models.Book {
+	if filter.IsEmpty() {
+		return books
+	}
+	matched := make([]*models.Book, 0, len(books))
+	for _, book := range books {
+		if filter.Matches(book) {
+			matched = append(matched, book)
+		}
+	}
+	return matched
+}
+
 func (h *BookHandler) CreateBook(w http.ResponseWriter, r *http.Request) {
 	var book models.Book
 	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
@@ -56,6 +126,18 @@ func (h *BookHandler) CreateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	newBook := newBookFrom(&book)
+	if err := h.repo.CreateBook(r.Context(), newBook); err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newBook)
+}
+
+// newBookFrom copies the client-settable fields of book into a new book with
+// a fresh ID and timestamps.
+func newBookFrom(book *models.Book) *models.Book {
 	newBook := models.NewBook()
 	newBook.AuthorID = book.AuthorID
 	newBook.PublisherID = book.PublisherID
@@ -67,26 +149,52 @@ func (h *BookHandler) CreateBook(w http.ResponseWriter, r *http.Request) {
 	newBook.Description = book.Description
 	newBook.Price = book.Price
 	newBook.Quantity = book.Quantity
-
-	if err := h.repo.CreateBook(newBook); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	respondWithJSON(w, http.StatusCreated, newBook)
+	return newBook
 }
 
 func (h *BookHandler) GetBook(w http.ResponseWriter, r *http.Request) { //to get single book by id
 	vars := mux.Vars(r)
 	id := vars["id"]
+	format, err := negotiate(w, r, bookFormats, errNoBookFormat)
+	if err != nil {
+		if r.URL.Query().Get("format") != "" {
+			respondWithError(w, http.StatusNotAcceptable, err.Error())
+			return
+		}
+		// A book was always JSON whatever the Accept header said, so an
+		// Accept with no MARC type still gets JSON.
+		format = responseFormats[0]
+	}
+	fields, err := parseFieldSet(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if fields != nil && format != responseFormats[0] {
+		respondWithError(w, http.StatusBadRequest, "fields and exclude only apply to JSON, not "+format.name)
+		return
+	}
 
-	book, err := h.repo.GetBookByID(id)
+	book, err := h.repo.GetBookByID(r.Context(), id)
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Book not found")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, book)
+	if notModified(w, r, format.etag(bookETag(book)), book.UpdatedAt) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if format != responseFormats[0] {
+		respondWithBooks(w, http.StatusOK, format, bookList{books: []*models.Book{book}})
+		return
+	}
+	respondWithJSON(w, http.StatusOK, fields.shape(book))
 }
 
 func (h *BookHandler) UpdateBook(w http.ResponseWriter, r *http.Request) {
@@ -104,12 +212,18 @@ func (h *BookHandler) UpdateBook(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	book, err := h.repo.UpdateBook(id, &updatedBook)
+	ifVersion, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	book, err := h.repo.UpdateBook(r.Context(), id, &updatedBook, ifVersion)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
+	w.Header().Set("ETag", bookETag(book))
 	respondWithJSON(w, http.StatusOK, book)
 }
 
@@ -117,29 +231,37 @@ func (h *BookHandler) DeleteBook(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	if err := h.repo.DeleteBook(id); err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+	ifVersion, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	if err := h.repo.DeleteBook(r.Context(), id, ifVersion); err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func getPaginationParams(r *http.Request) (limit, offset int) {
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
-
-	limit = 10
-	if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
-		limit = l
-	}
-
-	offset = 0
-	if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-		offset = o
+// statusForError maps request-context failures, a read-only store and failed
+// version checks to a status; every other error keeps the handler's own
+// fallback status.
+func statusForError(err error, fallback int) int {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled), errors.Is(err, storage.ErrReadOnly):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, repository.ErrVersionConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, repository.ErrBookNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errRecordTooLong):
+		return http.StatusUnprocessableEntity
+	default:
+		return fallback
 	}
-
-	return limit, offset
 }
 
 func respondWithError(w http.ResponseWriter, code int, message string) { //Sends a JSON error response to the client.
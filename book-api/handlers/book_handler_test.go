@@ -4,76 +4,37 @@ import (
 	"book-api/models"
 	"book-api/repository"
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"             //mux = router for path parameters (like /books/{id})
 	"github.com/stretchr/testify/assert" // helpful for writing readable test checks
+	"github.com/stretchr/testify/require"
 )
 
-type mockBookRepository struct { //A fake version of your real book repository. It avoids actual file/database calls during tests.
-	books []*models.Book
-}
-
-func (m *mockBookRepository) GetAllBooks() ([]*models.Book, error) {
-	return m.books, nil
-}
-
-func (m *mockBookRepository) GetBookByID(id string) (*models.Book, error) {
-	for _, book := range m.books {
-		if book.BookID == id {
-			return book, nil
-		}
-	}
-	return nil, repository.ErrBookNotFound
-}
-
-func (m *mockBookRepository) CreateBook(book *models.Book) error {
-	for _, b := range m.books {
-		if b.ISBN == book.ISBN {
-			return repository.ErrDuplicateISBN
-		}
-	}
-	m.books = append(m.books, book)
-	return nil
-}
-
-func (m *mockBookRepository) UpdateBook(id string, book *models.Book) (*models.Book, error) {
-	for i, b := range m.books {
-		if b.BookID == id {
-			for j, existing := range m.books {
-				if i != j && existing.ISBN == book.ISBN {
-					return nil, repository.ErrDuplicateISBN
-				}
-			}
-			book.BookID = id
-			book.CreatedAt = b.CreatedAt
-			m.books[i] = book
-			return book, nil
-		}
-	}
-	return nil, repository.ErrBookNotFound
-}
-
-func (m *mockBookRepository) DeleteBook(id string) error {
-	for i, book := range m.books {
-		if book.BookID == id {
-			m.books = append(m.books[:i], m.books[i+1:]...)
-			return nil
+func newTestRepository(t *testing.T, books ...*models.Book) *repository.MemoryBookRepository { //An in-memory repository seeded with the given books, so tests never touch the data file.
+	repo, err := repository.NewMemoryBookRepository(nil, 0)
+	require.NoError(t, err)
+	for _, book := range books {
+		if book.ISBN == "" {
+			// ISBNs are unique, and most fixtures do not care about theirs.
+			book.ISBN = "isbn-" + book.BookID
 		}
+		require.NoError(t, repo.CreateBook(context.Background(), book))
 	}
-	return repository.ErrBookNotFound
+	return repo
 }
 
 func TestBookHandler_GetBooks(t *testing.T) { //Tests the GET /books endpoint.
-	repo := &mockBookRepository{
-		books: []*models.Book{ //Creates a fake list of 2 books.
-			{BookID: "1", Title: "Book 1"},
-			{BookID: "2", Title: "Book 2"},
-		},
-	}
+	repo := newTestRepository(t, //Creates a fake list of 2 books.
+		&models.Book{BookID: "1", Title: "Book 1"},
+		&models.Book{BookID: "2", Title: "Book 2"},
+	)
 	handler := NewBookHandler(repo)
 
 	req, err := http.NewRequest("GET", "/books", nil)
@@ -92,8 +53,37 @@ func TestBookHandler_GetBooks(t *testing.T) { //Tests the GET /books endpoint.
 	assert.Len(t, data, 2)
 }
 
+func TestBookHandler_GetBooksEmptyCatalog(t *testing.T) {
+	sqlDB, err := repository.OpenSQLite(filepath.Join(t.TempDir(), "books.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { sqlDB.Close() })
+	sqlRepo, err := repository.NewSQLBookRepository(sqlDB)
+	require.NoError(t, err)
+
+	boltDB, err := repository.OpenBolt(filepath.Join(t.TempDir(), "books.bolt"))
+	require.NoError(t, err)
+	t.Cleanup(func() { boltDB.Close() })
+	boltRepo, err := repository.NewBoltBookRepository(boltDB)
+	require.NoError(t, err)
+
+	for name, repo := range map[string]repository.BookRepository{"sqlite": sqlRepo, "bolt": boltRepo} {
+		t.Run(name, func(t *testing.T) {
+			handler := NewBookHandler(repo)
+			for _, query := range []string{"", "?fields=title"} {
+				rr := httptest.NewRecorder()
+				handler.GetBooks(rr, httptest.NewRequest("GET", "/books"+query, nil))
+				require.Equal(t, http.StatusOK, rr.Code)
+
+				var response map[string]json.RawMessage
+				require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+				assert.JSONEq(t, `[]`, string(response["data"]), query)
+			}
+		})
+	}
+}
+
 func TestBookHandler_CreateBook(t *testing.T) {
-	repo := &mockBookRepository{books: []*models.Book{}}
+	repo := newTestRepository(t)
 	handler := NewBookHandler(repo)
 
 	newBook := models.Book{
@@ -125,11 +115,9 @@ func TestBookHandler_CreateBook(t *testing.T) {
 }
 
 func TestBookHandler_GetBook(t *testing.T) {
-	repo := &mockBookRepository{
-		books: []*models.Book{
-			{BookID: "1", Title: "Book 1"},
-		},
-	}
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Book 1"},
+	)
 	handler := NewBookHandler(repo)
 
 	req, err := http.NewRequest("GET", "/books/1", nil)
@@ -150,11 +138,9 @@ func TestBookHandler_GetBook(t *testing.T) {
 }
 
 func TestBookHandler_UpdateBook(t *testing.T) {
-	repo := &mockBookRepository{
-		books: []*models.Book{
-			{BookID: "1", Title: "Old Title"},
-		},
-	}
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Old Title"},
+	)
 	handler := NewBookHandler(repo)
 
 	updatedBook := models.Book{
@@ -187,11 +173,9 @@ func TestBookHandler_UpdateBook(t *testing.T) {
 }
 
 func TestBookHandler_DeleteBook(t *testing.T) {
-	repo := &mockBookRepository{
-		books: []*models.Book{
-			{BookID: "1", Title: "Book 1"},
-		},
-	}
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Book 1"},
+	)
 	handler := NewBookHandler(repo)
 
 	req, err := http.NewRequest("DELETE", "/books/1", nil)
@@ -205,3 +189,201 @@ func TestBookHandler_DeleteBook(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, rr.Code)
 	assert.Empty(t, rr.Body.String())
 }
+
+func TestBookHandler_IfMatch(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Book 1", AuthorID: "a", PublisherID: "p", ISBN: "111", Pages: 1, Price: 1},
+	)
+	handler := NewBookHandler(repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/books/{id}", handler.GetBook).Methods("GET")
+	router.HandleFunc("/books/{id}", handler.UpdateBook).Methods("PUT")
+	router.HandleFunc("/books/{id}", handler.DeleteBook).Methods("DELETE")
+
+	send := func(method, ifMatch string) *httptest.ResponseRecorder {
+		body := `{"title":"Changed","authorId":"a","publisherId":"p","isbn":"111","pages":1,"price":1}`
+		req := httptest.NewRequest(method, "/books/1", bytes.NewBufferString(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("GET", "")
+	assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+	rr = send("PUT", `"1"`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusPreconditionFailed, send("PUT", `"1"`).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, send("PUT", `W/"2"`).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, send("DELETE", `"1"`).Code)
+	assert.Equal(t, http.StatusOK, send("PUT", `"1", "2"`).Code)
+	assert.Equal(t, http.StatusOK, send("PUT", `*`).Code)
+
+	handler.RequireIfMatch = true
+	assert.Equal(t, http.StatusPreconditionRequired, send("PUT", "").Code)
+	assert.Equal(t, http.StatusPreconditionRequired, send("DELETE", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, send("DELETE", `"4"`).Code)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", `*`).Code)
+}
+
+func TestBookHandler_ConditionalGet(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Book 1", ISBN: "111", UpdatedAt: time.Now().Add(-time.Hour)},
+	)
+	handler := NewBookHandler(repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/books", handler.GetBooks).Methods("GET")
+	router.HandleFunc("/books/{id}", handler.GetBook).Methods("GET")
+	router.HandleFunc("/books/{id}", handler.UpdateBook).Methods("PUT")
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("list", func(t *testing.T) {
+		first := get("/books", nil)
+		require.Equal(t, http.StatusOK, first.Code)
+		etag := first.Header().Get("ETag")
+		require.NotEmpty(t, etag)
+		assert.NotEmpty(t, first.Header().Get("Last-Modified"))
+
+		rr := get("/books", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+		assert.Equal(t, etag, rr.Header().Get("ETag"))
+
+		require.NoError(t, repo.CreateBook(context.Background(), &models.Book{BookID: "2", ISBN: "222"}))
+		rr = get("/books", map[string]string{"If-None-Match": etag})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+	})
+
+	t.Run("list after a deletion", func(t *testing.T) {
+		first := get("/books", nil)
+		require.Equal(t, http.StatusOK, first.Code)
+		lastModified := first.Header().Get("Last-Modified")
+		require.NotEmpty(t, lastModified)
+		assert.Equal(t, http.StatusNotModified, get("/books", map[string]string{"If-Modified-Since": lastModified}).Code)
+
+		// Last-Modified has whole seconds; delete in a later one.
+		since, err := http.ParseTime(lastModified)
+		require.NoError(t, err)
+		time.Sleep(time.Until(since.Add(time.Second)))
+		require.NoError(t, repo.DeleteBook(context.Background(), "2", repository.AnyVersion))
+
+		rr := get("/books", map[string]string{"If-Modified-Since": lastModified})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEqual(t, lastModified, rr.Header().Get("Last-Modified"))
+	})
+
+	t.Run("single book", func(t *testing.T) {
+		first := get("/books/1", nil)
+		require.Equal(t, http.StatusOK, first.Code)
+		lastModified := first.Header().Get("Last-Modified")
+
+		assert.Equal(t, http.StatusNotModified, get("/books/1", map[string]string{"If-None-Match": `W/"1"`}).Code)
+		assert.Equal(t, http.StatusNotModified, get("/books/1", map[string]string{"If-Modified-Since": lastModified}).Code)
+		assert.Equal(t, http.StatusOK, get("/books/1", map[string]string{"If-None-Match": `"7"`}).Code)
+
+		body := `{"title":"Changed","authorId":"a","publisherId":"p","isbn":"111","pages":1,"price":1}`
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("PUT", "/books/1", bytes.NewBufferString(body)))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		assert.Equal(t, http.StatusOK, get("/books/1", map[string]string{"If-None-Match": `"1"`}).Code)
+		assert.Equal(t, http.StatusOK, get("/books/1", map[string]string{"If-Modified-Since": lastModified}).Code)
+	})
+}
+
+func TestBookHandler_GetBooksFilterAndSort(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "The Hobbit", Genre: "Fantasy", AuthorID: "tolkien", ISBN: "1", Price: 12, Pages: 310, Quantity: 4, PublicationDate: "1937-09-21"},
+		&models.Book{BookID: "2", Title: "A Game of Thrones", Genre: "Fantasy", AuthorID: "martin", ISBN: "2", Price: 15, Pages: 694, Quantity: 0, PublicationDate: "1996-08-01"},
+		&models.Book{BookID: "3", Title: "Dune", Genre: "Science Fiction", AuthorID: "herbert", ISBN: "3", Price: 12, Pages: 412, Quantity: 2, PublicationDate: "1965-08-01"},
+		&models.Book{BookID: "4", Title: "Anathem", Genre: "Science Fiction", AuthorID: "stephenson", ISBN: "4", Price: 20, Pages: 937, Quantity: 1},
+	)
+	handler := NewBookHandler(repo)
+
+	get := func(query string) (*httptest.ResponseRecorder, []string) {
+		rr := httptest.NewRecorder()
+		handler.GetBooks(rr, httptest.NewRequest("GET", "/books?"+query, nil))
+		var response struct {
+			Data  []models.Book `json:"data"`
+			Total int           `json:"total"`
+		}
+		var ids []string
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			for _, book := range response.Data {
+				ids = append(ids, book.BookID)
+			}
+			assert.Equal(t, len(ids), response.Total)
+		}
+		return rr, ids
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"genre=fantasy", []string{"1", "2"}},
+		{"authorId=herbert", []string{"3"}},
+		{"minPrice=12&maxPrice=15", []string{"1", "2", "3"}},
+		{"minPages=400&maxPages=700", []string{"2", "3"}},
+		{"inStock=true", []string{"1", "3", "4"}},
+		{"inStock=false", []string{"2"}},
+		{"publishedAfter=1960-01-01", []string{"2", "3"}},
+		{"publishedAfter=1937-09-21&publishedBefore=1965-08-01", []string{"1", "3"}},
+		{"genre=Poetry", nil},
+		{"sort=title", []string{"4", "3", "2", "1"}},
+		{"sort=-title", []string{"1", "2", "3", "4"}},
+		{"sort=price,-pages", []string{"3", "1", "2", "4"}},
+		{"sort=-price,title", []string{"4", "2", "3", "1"}},
+		{"genre=Science+Fiction&sort=-quantity", []string{"3", "4"}},
+	}
+	for _, tc := range cases {
+		rr, ids := get(tc.query)
+		require.Equal(t, http.StatusOK, rr.Code, tc.query)
+		assert.Equal(t, tc.want, ids, tc.query)
+	}
+
+	for _, query := range []string{
+		"limit=abc", "limit=0", "offset=-1",
+		"minPrice=cheap", "maxPrice=-5", "minPrice=20&maxPrice=10",
+		"minPages=1.5", "inStock=maybe",
+		"publishedAfter=1990", "publishedAfter=2000-01-01&publishedBefore=1990-01-01",
+		"sort=rating", "sort=title,", "sort=--price",
+		"genr=Fantasy", "genre=Fantasy&minprice=5",
+	} {
+		rr, _ := get(query)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		assert.Contains(t, rr.Body.String(), "invalid", query)
+	}
+
+	rr, _ := get("genr=Fantasy")
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.Contains(t, body["error"], `"genr"`)
+	assert.Contains(t, body["error"], "genre, inStock")
+}
+
+func TestTitleCollationKey(t *testing.T) {
+	assert.Equal(t, "hobbit", titleCollationKey("The Hobbit"))
+	assert.Equal(t, "game of thrones", titleCollationKey("A Game of Thrones"))
+	assert.Equal(t, "american tragedy", titleCollationKey("An American Tragedy"))
+	assert.Equal(t, "anathem", titleCollationKey("Anathem"))
+	assert.Equal(t, "the", titleCollationKey("The"))
+	assert.Equal(t, "theory of everything", titleCollationKey("Theory of Everything"))
+}
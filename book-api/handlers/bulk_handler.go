@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"book-api/models"
+	"book-api/patch"
+	"book-api/repository"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+const maxBulkOperations = 10000
+
+type bulkRequest struct {
+	// Atomic applies every operation in a single store write, or none.
+	Atomic     bool            `json:"atomic"`
+	Operations []bulkOperation `json:"operations"`
+}
+
+// bulkOperation is one entry of POST /books/bulk. Op is create, update,
+// delete or updateWhere. Version is the If-Match of update and delete, 0 for
+// any. updateWhere merge-patches every book matching Filter with Set and/or
+// multiplies its price by PriceFactor.
+type bulkOperation struct {
+	Op          string                `json:"op"`
+	ID          string                `json:"id,omitempty"`
+	Version     int64                 `json:"version,omitempty"`
+	Book        *models.Book          `json:"book,omitempty"`
+	Filter      repository.BookFilter `json:"filter"`
+	Set         json.RawMessage       `json:"set,omitempty"`
+	PriceFactor float64               `json:"priceFactor,omitempty"`
+}
+
+type bulkResult struct {
+	Index   int          `json:"index"`
+	Op      string       `json:"op"`
+	Status  string       `json:"status"`
+	Code    int          `json:"code"`
+	ID      string       `json:"id,omitempty"`
+	Book    *models.Book `json:"book,omitempty"`
+	Updated *int         `json:"updated,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// bulkError is an operation failure with the status it is reported with.
+type bulkError struct {
+	code int
+	msg  string
+}
+
+func (e *bulkError) Error() string { return e.msg }
+
+// BulkBooks applies a batch of creates, updates, deletes and filtered updates
+// and reports the outcome of each. A non-atomic batch answers 200 even when
+// some operations failed; an atomic batch that was rolled back answers 422.
+func (h *BookHandler) BulkBooks(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if len(req.Operations) == 0 {
+		respondWithError(w, http.StatusBadRequest, "operations must not be empty")
+		return
+	}
+	if len(req.Operations) > maxBulkOperations {
+		respondWithError(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("at most %d operations are allowed per request", maxBulkOperations))
+		return
+	}
+
+	results := make([]bulkResult, len(req.Operations))
+	var (
+		ops     []repository.BatchOp
+		indexes []int
+		invalid bool
+	)
+	for i, operation := range req.Operations {
+		results[i] = bulkResult{Index: i, Op: operation.Op, ID: operation.ID}
+		op, err := h.batchOp(operation)
+		if err != nil {
+			setBulkError(&results[i], err)
+			invalid = true
+			continue
+		}
+		ops = append(ops, op)
+		indexes = append(indexes, i)
+	}
+
+	if invalid && req.Atomic {
+		for i := range results {
+			if results[i].Status == "" {
+				setBulkError(&results[i], repository.ErrBatchAborted)
+			}
+		}
+		respondWithBulk(w, http.StatusUnprocessableEntity, req.Atomic, false, results)
+		return
+	}
+
+	batchResults, err := h.repo.ApplyBatch(r.Context(), ops, req.Atomic)
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	applied := true
+	for j, result := range batchResults {
+		item := &results[indexes[j]]
+		if result.Err != nil {
+			setBulkError(item, result.Err)
+			if ops[j].Kind == repository.BatchUpdateWhere && !req.Atomic {
+				// The books changed before the failure stay changed.
+				n := len(result.Updated)
+				item.Updated = &n
+			}
+			applied = false
+			continue
+		}
+		setBulkSuccess(item, ops[j].Kind, result)
+	}
+
+	status := http.StatusOK
+	if req.Atomic && !applied {
+		status = http.StatusUnprocessableEntity
+	}
+	respondWithBulk(w, status, req.Atomic, applied || !req.Atomic, results)
+}
+
+// batchOp checks one operation and turns it into its repository form.
+func (h *BookHandler) batchOp(op bulkOperation) (repository.BatchOp, error) {
+	switch repository.BatchOpKind(op.Op) {
+	case repository.BatchCreate:
+		if op.Book == nil {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "book is required"}
+		}
+		if err := op.Book.Validate(); err != nil {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, err.Error()}
+		}
+		return repository.BatchOp{Kind: repository.BatchCreate, Book: newBookFrom(op.Book)}, nil
+
+	case repository.BatchUpdate, repository.BatchDelete:
+		if op.ID == "" {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "id is required"}
+		}
+		if op.Version < 0 {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "version must not be negative"}
+		}
+		if op.Version == repository.AnyVersion && h.RequireIfMatch {
+			return repository.BatchOp{}, &bulkError{http.StatusPreconditionRequired, "version is required"}
+		}
+		if op.Op == string(repository.BatchDelete) {
+			return repository.BatchOp{Kind: repository.BatchDelete, ID: op.ID, IfVersion: op.Version}, nil
+		}
+
+		if op.Book == nil {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "book is required"}
+		}
+		if err := op.Book.Validate(); err != nil {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, err.Error()}
+		}
+		return repository.BatchOp{Kind: repository.BatchUpdate, ID: op.ID, Book: op.Book, IfVersion: op.Version}, nil
+
+	case repository.BatchUpdateWhere:
+		if op.Filter.IsEmpty() {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "filter must not be empty"}
+		}
+		if len(op.Set) == 0 && op.PriceFactor == 0 {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "set or priceFactor is required"}
+		}
+		if op.PriceFactor < 0 {
+			return repository.BatchOp{}, &bulkError{http.StatusBadRequest, "priceFactor must not be negative"}
+		}
+		return repository.BatchOp{Kind: repository.BatchUpdateWhere, Filter: op.Filter, Change: bookChange(op)}, nil
+
+	default:
+		return repository.BatchOp{}, &bulkError{http.StatusBadRequest, fmt.Sprintf("unknown op %q", op.Op)}
+	}
+}
+
+// bookChange applies an updateWhere's Set and PriceFactor to one book.
+func bookChange(op bulkOperation) func(book *models.Book) error {
+	return func(book *models.Book) error {
+		if len(op.Set) > 0 {
+			patched, status, err := patchBook(book, op.Set, patch.MergePatch)
+			if err != nil {
+				return &bulkError{status, err.Error()}
+			}
+			*book = *patched
+		}
+		if op.PriceFactor != 0 {
+			book.Price = math.Round(book.Price*op.PriceFactor*100) / 100
+		}
+		if err := book.Validate(); err != nil {
+			return &bulkError{http.StatusBadRequest, fmt.Sprintf("book %s: %v", book.BookID, err)}
+		}
+		return nil
+	}
+}
+
+func setBulkSuccess(item *bulkResult, kind repository.BatchOpKind, result repository.BatchResult) {
+	switch kind {
+	case repository.BatchCreate:
+		item.Status, item.Code = "created", http.StatusCreated
+	case repository.BatchDelete:
+		item.Status, item.Code = "deleted", http.StatusNoContent
+	default:
+		item.Status, item.Code = "updated", http.StatusOK
+	}
+
+	if result.Book != nil {
+		item.Book = result.Book
+		item.ID = result.Book.BookID
+	}
+	if kind == repository.BatchUpdateWhere {
+		n := len(result.Updated)
+		item.Updated = &n
+	}
+}
+
+func setBulkError(item *bulkResult, err error) {
+	item.Status, item.Error = "failed", err.Error()
+
+	var be *bulkError
+	switch {
+	case errors.As(err, &be):
+		item.Code = be.code
+	case errors.Is(err, repository.ErrBatchAborted):
+		item.Status, item.Code = "skipped", http.StatusFailedDependency
+	case errors.Is(err, repository.ErrDuplicateISBN), errors.Is(err, repository.ErrDuplicateID):
+		item.Code = http.StatusConflict
+	default:
+		item.Code = statusForError(err, http.StatusInternalServerError)
+	}
+}
+
+func respondWithBulk(w http.ResponseWriter, code int, atomic, applied bool, results []bulkResult) {
+	succeeded := 0
+	for _, result := range results {
+		if result.Code < 300 {
+			succeeded++
+		}
+	}
+
+	respondWithJSON(w, code, map[string]interface{}{
+		"atomic":    atomic,
+		"applied":   applied,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	})
+}
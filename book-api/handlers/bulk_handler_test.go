@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"book-api/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bulkResponse struct {
+	Atomic    bool         `json:"atomic"`
+	Applied   bool         `json:"applied"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []bulkResult `json:"results"`
+}
+
+func TestBookHandler_BulkBooks(t *testing.T) {
+	newBook := func(id, isbn, genre string) *models.Book {
+		return &models.Book{BookID: id, Title: "Book " + id, AuthorID: "a", PublisherID: "p", ISBN: isbn, Pages: 10, Price: 10, Genre: genre}
+	}
+	repo := newTestRepository(t,
+		newBook("1", "111", "Fantasy"),
+		newBook("2", "222", "Fantasy"),
+		newBook("3", "333", "Poetry"),
+	)
+	handler := NewBookHandler(repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/books/bulk", handler.BulkBooks).Methods("POST")
+
+	send := func(body string) (*httptest.ResponseRecorder, bulkResponse) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/books/bulk", bytes.NewBufferString(body)))
+		var resp bulkResponse
+		if rr.Code != http.StatusBadRequest {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp), rr.Body.String())
+		}
+		return rr, resp
+	}
+	price := func(id string) float64 {
+		book, err := repo.GetBookByID(context.Background(), id)
+		require.NoError(t, err)
+		return book.Price
+	}
+
+	t.Run("atomic rollback", func(t *testing.T) {
+		rr, resp := send(`{"atomic":true,"operations":[
+			{"op":"updateWhere","filter":{"genre":"fantasy"},"priceFactor":1.1},
+			{"op":"create","book":{"title":"New","authorId":"a","publisherId":"p","isbn":"111","pages":1,"price":1}}
+		]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.False(t, resp.Applied)
+		require.Len(t, resp.Results, 2)
+		assert.Equal(t, "skipped", resp.Results[0].Status)
+		assert.Equal(t, http.StatusFailedDependency, resp.Results[0].Code)
+		assert.Equal(t, http.StatusConflict, resp.Results[1].Code)
+		assert.Equal(t, 10.0, price("1"))
+	})
+
+	t.Run("atomic validation failure", func(t *testing.T) {
+		rr, resp := send(`{"atomic":true,"operations":[
+			{"op":"delete","id":"3"},
+			{"op":"create","book":{"title":""}}
+		]}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Equal(t, "skipped", resp.Results[0].Status)
+		assert.Equal(t, http.StatusBadRequest, resp.Results[1].Code)
+		assert.NotEmpty(t, resp.Results[1].Error)
+		_, err := repo.GetBookByID(context.Background(), "3")
+		assert.NoError(t, err)
+	})
+
+	t.Run("atomic success", func(t *testing.T) {
+		rr, resp := send(`{"atomic":true,"operations":[
+			{"op":"updateWhere","filter":{"genre":"Fantasy"},"priceFactor":1.1,"set":{"quantity":5}},
+			{"op":"delete","id":"3","version":1},
+			{"op":"create","book":{"title":"New","authorId":"a","publisherId":"p","isbn":"444","pages":1,"price":1}}
+		]}`)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.True(t, resp.Applied)
+		assert.Equal(t, 3, resp.Succeeded)
+		require.NotNil(t, resp.Results[0].Updated)
+		assert.Equal(t, 2, *resp.Results[0].Updated)
+		assert.Equal(t, "deleted", resp.Results[1].Status)
+		assert.Equal(t, "created", resp.Results[2].Status)
+		assert.NotEmpty(t, resp.Results[2].ID)
+
+		assert.Equal(t, 11.0, price("1"))
+		book, err := repo.GetBookByID(context.Background(), "2")
+		require.NoError(t, err)
+		assert.Equal(t, 5, book.Quantity)
+		assert.Equal(t, int64(2), book.Version)
+	})
+
+	t.Run("independent operations", func(t *testing.T) {
+		rr, resp := send(`{"operations":[
+			{"op":"update","id":"1","version":1,"book":{"title":"Stale","authorId":"a","publisherId":"p","isbn":"111","pages":1,"price":1}},
+			{"op":"update","id":"1","version":2,"book":{"title":"Fresh","authorId":"a","publisherId":"p","isbn":"111","pages":1,"price":1}},
+			{"op":"delete","id":"missing"},
+			{"op":"updateWhere","filter":{"genre":"Fantasy"},"set":{"bookId":"x"}},
+			{"op":"frobnicate"}
+		]}`)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, 1, resp.Succeeded)
+		assert.Equal(t, 4, resp.Failed)
+		assert.Equal(t, http.StatusPreconditionFailed, resp.Results[0].Code)
+		assert.Equal(t, "updated", resp.Results[1].Status)
+		assert.Equal(t, "Fresh", resp.Results[1].Book.Title)
+		assert.Equal(t, http.StatusNotFound, resp.Results[2].Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, resp.Results[3].Code)
+		assert.Equal(t, http.StatusBadRequest, resp.Results[4].Code)
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		rr, _ := send(`{"operations":[]}`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		rr, _ = send(`not json`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		_, resp := send(`{"operations":[{"op":"updateWhere","filter":{},"priceFactor":2}]}`)
+		assert.Equal(t, http.StatusBadRequest, resp.Results[0].Code)
+	})
+
+	t.Run("require if-match", func(t *testing.T) {
+		handler.RequireIfMatch = true
+		defer func() { handler.RequireIfMatch = false }()
+		_, resp := send(`{"operations":[{"op":"delete","id":"1"}]}`)
+		assert.Equal(t, http.StatusPreconditionRequired, resp.Results[0].Code)
+	})
+}
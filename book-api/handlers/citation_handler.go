@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"book-api/citation"
+	"book-api/models"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// GetCitation cites one book in the style given by style: bibtex (the
+// default), ris or csl-json.
+func (h *BookHandler) GetCitation(w http.ResponseWriter, r *http.Request) {
+	style, err := citationStyle(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	book, err := h.repo.GetBookByID(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Book not found")
+		return
+	}
+	respondWithCitations(w, style, []*models.Book{book})
+}
+
+// GetCitations cites the books listed by ids, comma-separated or repeated,
+// in the order given. Up to MaxPageSize books can be cited at once, and an
+// unknown ID fails the whole request with 404.
+func (h *BookHandler) GetCitations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	style, err := citationStyle(q)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, v := range q["ids"] {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				ids, seen[id] = append(ids, id), true
+			}
+		}
+	}
+	if len(ids) == 0 {
+		respondWithError(w, http.StatusBadRequest, (&queryError{"ids", q.Get("ids"), "must list at least one book ID"}).Error())
+		return
+	}
+	if limit := maxPageSize(h.MaxPageSize); len(ids) > limit {
+		respondWithError(w, http.StatusBadRequest, (&queryError{"ids", q.Get("ids"), fmt.Sprintf("must list at most %d book IDs", limit)}).Error())
+		return
+	}
+
+	all, err := h.repo.GetAllBooks(r.Context())
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	byID := make(map[string]*models.Book, len(all))
+	for _, book := range all {
+		byID[book.BookID] = book
+	}
+	books := make([]*models.Book, 0, len(ids))
+	var missing []string
+	for _, id := range ids {
+		if book, ok := byID[id]; ok {
+			books = append(books, book)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		respondWithError(w, http.StatusNotFound, "books not found: "+strings.Join(missing, ", "))
+		return
+	}
+	respondWithCitations(w, style, books)
+}
+
+func citationStyle(q url.Values) (*citation.Style, error) {
+	name := q.Get("style")
+	if name == "" {
+		return citation.BibTeX, nil
+	}
+	style, ok := citation.Lookup(name)
+	if !ok {
+		var names []string
+		for _, s := range citation.Styles {
+			names = append(names, s.Name)
+		}
+		return nil, &queryError{"style", name, "styles are " + strings.Join(names, ", ")}
+	}
+	return style, nil
+}
+
+func respondWithCitations(w http.ResponseWriter, style *citation.Style, books []*models.Book) {
+	var buf bytes.Buffer
+	if err := style.Write(&buf, citation.Entries(books)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", style.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
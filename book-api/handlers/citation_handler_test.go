@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"book-api/models"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookHandler_Citations(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "The Hobbit", AuthorID: "J. R. R. Tolkien", PublisherID: "Allen & Unwin", PublicationDate: "1937-09-21", ISBN: "9780618260300"},
+		&models.Book{BookID: "2", Title: "Dune", AuthorID: "Frank Herbert", PublisherID: "Chilton", PublicationDate: "1965", ISBN: "9780441172719"},
+		&models.Book{BookID: "3", Title: "Dune", AuthorID: "Frank Herbert", PublisherID: "Ace", PublicationDate: "1965", ISBN: "9780441013593"},
+	)
+	handler := NewBookHandler(repo)
+	handler.MaxPageSize = 2
+	router := mux.NewRouter()
+	router.HandleFunc("/books/citations", handler.GetCitations)
+	router.HandleFunc("/books/{id}/citation", handler.GetCitation)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		return rr
+	}
+
+	t.Run("single", func(t *testing.T) {
+		rr := get("/books/1/citation")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "application/x-bibtex; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.True(t, strings.HasPrefix(rr.Body.String(), "@book{tolkien1937hobbit-fada,\n"))
+		assert.Contains(t, rr.Body.String(), `publisher = {Allen \& Unwin},`)
+
+		rr = get("/books/1/citation?style=ris")
+		assert.Equal(t, "application/x-research-info-systems; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "TY  - BOOK\r\nID  - tolkien1937hobbit-fada\r\n")
+
+		rr = get("/books/1/citation?style=csl-json")
+		assert.Equal(t, "application/vnd.citationstyles.csl+json", rr.Header().Get("Content-Type"))
+		var items []map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &items))
+		assert.Equal(t, "tolkien1937hobbit-fada", items[0]["id"])
+		assert.Equal(t, "9780618260300", items[0]["ISBN"])
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		rr := get("/books/citations?ids=2,1&style=csl-json")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		var items []map[string]any
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &items))
+		require.Len(t, items, 2)
+		assert.Equal(t, "herbert1965dune-9b07", items[0]["id"])
+		assert.Equal(t, "tolkien1937hobbit-fada", items[1]["id"])
+
+		// The two editions of Dune are told apart by their ISBNs, with the
+		// keys they have when cited alone.
+		for _, target := range []string{"/books/citations?ids=2&ids=3", "/books/citations?ids=3,2,3"} {
+			rr = get(target)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			body := rr.Body.String()
+			assert.Contains(t, body, "@book{herbert1965dune-9b07,\n  author = {Herbert, Frank},\n  title = {Dune},\n  publisher = {Chilton},")
+			assert.Contains(t, body, "@book{herbert1965dune-2277,\n  author = {Herbert, Frank},\n  title = {Dune},\n  publisher = {Ace},")
+			assert.Equal(t, 2, strings.Count(body, "@book{"))
+		}
+		assert.Contains(t, get("/books/2/citation").Body.String(), "@book{herbert1965dune-9b07,")
+		assert.Contains(t, get("/books/3/citation").Body.String(), "@book{herbert1965dune-2277,")
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		for _, tc := range []struct {
+			target string
+			code   int
+		}{
+			{"/books/1/citation?style=mla", http.StatusBadRequest},
+			{"/books/9/citation", http.StatusNotFound},
+			{"/books/citations", http.StatusBadRequest},
+			{"/books/citations?ids=,", http.StatusBadRequest},
+			{"/books/citations?ids=1,2,3", http.StatusBadRequest},
+			{"/books/citations?ids=1,9", http.StatusNotFound},
+		} {
+			rr := get(tc.target)
+			assert.Equal(t, tc.code, rr.Code, tc.target)
+		}
+		assert.Contains(t, get("/books/1/citation?style=mla").Body.String(), "bibtex, ris, csl-json")
+		assert.Contains(t, get("/books/citations?ids=8,9").Body.String(), "books not found: 8, 9")
+	})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// encodeJSON writes the envelope of GET /books for a page and a bare array
+// otherwise, as the JSON API always has.
+func encodeJSON(w io.Writer, list bookList) error {
+	var payload interface{} = list.fields.shapeAll(list.books)
+	if p := list.page; p != nil {
+		payload = map[string]interface{}{
+			"data":   payload,
+			"total":  p.total,
+			"limit":  p.limit,
+			"offset": p.offset,
+			"next":   nullable(p.next),
+			"prev":   nullable(p.prev),
+		}
+	}
+	return json.NewEncoder(w).Encode(payload)
+}
+
+// encodeCSV writes a header row of field names and a row per book. Paging
+// details travel in the Link and X-Total-Count headers.
+func encodeCSV(w io.Writer, list bookList) error {
+	cw := csv.NewWriter(w)
+	cw.Write(list.fields.names())
+	for _, book := range list.books {
+		values, err := list.fields.values(book)
+		if err != nil {
+			return err
+		}
+		row := make([]string, len(values))
+		for i, value := range values {
+			row[i] = csvCell(value)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell is fieldText for a CSV cell. Spreadsheets run a cell starting with
+// =, +, -, @, tab or carriage return as a formula, so such text is prefixed
+// with a single quote to keep a crafted title from executing on open.
+// Numbers are left alone: a negative number is not a formula.
+func csvCell(raw json.RawMessage) string {
+	text := fieldText(raw)
+	if len(raw) == 0 || raw[0] != '"' || text == "" {
+		return text
+	}
+	if strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
+
+// encodeXML writes a books element holding a book element per book, with the
+// paging details of GET /books as attributes.
+func encodeXML(w io.Writer, list bookList) error {
+	root := xml.StartElement{Name: xml.Name{Local: "books"}}
+	if p := list.page; p != nil {
+		attr := func(name, value string) {
+			root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+		}
+		attr("total", strconv.Itoa(p.total))
+		attr("limit", strconv.Itoa(p.limit))
+		attr("offset", strconv.Itoa(p.offset))
+		if p.next != "" {
+			attr("next", p.next)
+		}
+		if p.prev != "" {
+			attr("prev", p.prev)
+		}
+	}
+
+	io.WriteString(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.EncodeToken(root); err != nil {
+		return err
+	}
+	names := list.fields.names()
+	for _, book := range list.books {
+		values, err := list.fields.values(book)
+		if err != nil {
+			return err
+		}
+		el := xml.StartElement{Name: xml.Name{Local: "book"}}
+		if err := enc.EncodeToken(el); err != nil {
+			return err
+		}
+		for i, name := range names {
+			if err := enc.EncodeElement(fieldText(values[i]), xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+				return err
+			}
+		}
+		if err := enc.EncodeToken(el.End()); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// fieldText is a JSON value as plain text: strings unquoted, null empty.
+func fieldText(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	return string(raw)
+}
+
+// encodeYAML writes the JSON representation as block-style YAML, so both
+// have the same structure and field order. Strings stay double-quoted, which
+// YAML reads exactly as JSON does.
+func encodeYAML(w io.Writer, list bookList) error {
+	var buf bytes.Buffer
+	if err := encodeJSON(&buf, list); err != nil {
+		return err
+	}
+	dec := json.NewDecoder(&buf)
+	dec.UseNumber()
+	root, err := readYAMLNode(dec)
+	if err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// readYAMLNode reads a JSON value as a YAML node, keeping the order of
+// object keys that decoding into a map would lose.
+func readYAMLNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if t == '{' {
+			n.Kind, n.Tag = yaml.MappingNode, "!!map"
+		}
+		for dec.More() {
+			if n.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			item, err := readYAMLNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, item)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if len(n.Content) == 0 {
+			n.Style = yaml.FlowStyle
+		}
+		return n, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t, Style: yaml.DoubleQuotedStyle}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(t)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	default:
+		return nil, fmt.Errorf("unexpected JSON token %v", tok)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"book-api/models"
+	"book-api/repository"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bookETag is the strong entity tag of a book's current version.
+func bookETag(book *models.Book) string {
+	return `"` + strconv.FormatInt(book.Version, 10) + `"`
+}
+
+// catalogETag is the catalog-wide version: it changes whenever a book is
+// added, removed, reordered or updated.
+func catalogETag(books []*models.Book) string {
+	h := sha256.New()
+	for _, book := range books {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", book.BookID, book.Version, book.UpdatedAt.UnixNano())
+	}
+	return `"c-` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// notModified sets the ETag and Last-Modified validators on w and reports
+// whether the request's conditional headers allow a 304. If-None-Match takes
+// precedence over If-Modified-Since.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, modified time.Time) bool {
+	w.Header().Set("ETag", etag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			// If-None-Match uses weak comparison.
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if modified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.Truncate(time.Second).After(since)
+}
+
+// parseBookETag reads a tag produced by bookETag. Weak tags never match for
+// If-Match, which requires strong comparison.
+func parseBookETag(tag string) (int64, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(tag[1:len(tag)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// ifMatchVersion turns the If-Match header of a write to book id into the
+// version the repository must find. Without the header, or with "*", any
+// version is accepted unless RequireIfMatch is set. ok is false when an error
+// response has been written.
+func (h *BookHandler) ifMatchVersion(w http.ResponseWriter, r *http.Request, id string) (version int64, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch {
+	case header == "" && h.RequireIfMatch:
+		respondWithError(w, http.StatusPreconditionRequired, "If-Match header with the book's ETag is required")
+		return 0, false
+	case header == "" || header == "*":
+		return repository.AnyVersion, true
+	}
+
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		if v, ok := parseBookETag(strings.TrimSpace(tag)); ok {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 1 {
+		return versions[0], true
+	}
+	if len(versions) > 1 {
+		// Pin whichever listed version is current; the repository re-checks
+		// it atomically with the write.
+		if book, err := h.repo.GetBookByID(r.Context(), id); err == nil {
+			for _, v := range versions {
+				if v == book.Version {
+					return v, true
+				}
+			}
+		}
+	}
+
+	respondWithError(w, http.StatusPreconditionFailed, repository.ErrVersionConflict.Error())
+	return 0, false
+}
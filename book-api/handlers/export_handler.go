@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"book-api/marc"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// marcFormats are the MARC 21 representations of books, MARCXML unless the
+// client asks for ISO 2709.
+var marcFormats = []*responseFormat{
+	{name: "marcxml", contentType: "application/marcxml+xml; charset=utf-8", mediaTypes: []string{"application/marcxml+xml"}, encode: encodeMARCXML},
+	{name: "marc", contentType: "application/marc", mediaTypes: []string{"application/marc"}, encode: encodeMARC},
+}
+
+var errNoMARCFormat = notAcceptable(marcFormats)
+
+// bookFormats are the representations of a single book: JSON, or MARC 21
+// when asked for.
+var (
+	bookFormats     = append([]*responseFormat{responseFormats[0]}, marcFormats...)
+	errNoBookFormat = notAcceptable(bookFormats)
+)
+
+// ExportBooks exports the catalog, or the books matching the filters of
+// GET /books, as MARC 21 records in MARCXML or ISO 2709 (format=marcxml or
+// marc, or the matching Accept).
+func (h *BookHandler) ExportBooks(w http.ResponseWriter, r *http.Request) {
+	format, err := negotiate(w, r, marcFormats, errNoMARCFormat)
+	if err != nil {
+		respondWithError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	filter, err := parseBookFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	keys, err := parseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(keys) == 0 {
+		keys = defaultSort
+	}
+
+	// As in GetBooks, the stamp is read first.
+	modified, err := h.repo.CatalogModified(r.Context())
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	books, err := h.repo.GetAllBooks(r.Context())
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	if notModified(w, r, format.etag(catalogETag(books)), modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	books = filterBooks(books, filter)
+	sortBooks(books, keys)
+	respondWithBooks(w, http.StatusOK, format, bookList{books: books})
+}
+
+func encodeMARCXML(w io.Writer, list bookList) error {
+	records := make([]marc.Record, 0, len(list.books))
+	for _, book := range list.books {
+		records = append(records, marc.FromBook(book))
+	}
+	return marc.WriteXML(w, records)
+}
+
+// errRecordTooLong is answered with 422: the books exist, but not every one
+// can be written as ISO 2709.
+var errRecordTooLong = errors.New("MARC record is longer than ISO 2709 allows, request format=marcxml instead")
+
+// encodeMARC writes a record per book. If any book's record does not fit in
+// ISO 2709 the export fails with errRecordTooLong naming every such book, as
+// a file silently missing records would look complete.
+func encodeMARC(w io.Writer, list bookList) error {
+	var tooLong []string
+	for _, book := range list.books {
+		data, err := marc.Marshal(marc.FromBook(book))
+		if err != nil {
+			tooLong = append(tooLong, book.BookID)
+			continue
+		}
+		if len(tooLong) > 0 {
+			continue
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	if len(tooLong) > 0 {
+		return fmt.Errorf("book %s: %w", strings.Join(tooLong, ", "), errRecordTooLong)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"book-api/marc"
+	"book-api/models"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookHandler_ExportBooks(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Dune", PublisherID: "Ace", ISBN: "9780441172719", PublicationDate: "1990", Pages: 604, Genre: "Science Fiction"},
+		&models.Book{BookID: "2", Title: "Emma", PublisherID: "Penguin", ISBN: "0141439580", Genre: "Classics"},
+		&models.Book{BookID: "3", Title: "The Hobbit", PublisherID: "Houghton Mifflin", ISBN: "9780618260300", Genre: "Fantasy"},
+		&models.Book{BookID: "4", Title: "Summa", ISBN: "9780000000001", Genre: "Reference", Description: strings.Repeat("lorem ipsum ", 1000)},
+		&models.Book{BookID: "5", Title: "Tome", ISBN: "9780000000002", Genre: "Reference", Description: strings.Repeat("lorem ipsum ", 10000)},
+	)
+	router := mux.NewRouter()
+	handler := NewBookHandler(repo)
+	router.HandleFunc("/books/export", handler.ExportBooks)
+	router.HandleFunc("/books/{id}", handler.GetBook)
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	titles := func(records []marc.Record) []string {
+		var titles []string
+		for _, r := range records {
+			titles = append(titles, marc.ToBook(r).Title)
+		}
+		return titles
+	}
+
+	t.Run("marcxml", func(t *testing.T) {
+		rr := get("/books/export", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "application/marcxml+xml; charset=utf-8", rr.Header().Get("Content-Type"))
+		records, err := marc.ReadXML(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Dune", "Emma", "The Hobbit", "Summa", "Tome"}, titles(records))
+
+		book := marc.ToBook(records[0])
+		assert.Equal(t, "9780441172719", book.ISBN)
+		assert.Equal(t, 604, book.Pages)
+		assert.Equal(t, "Science Fiction", book.Genre)
+	})
+
+	t.Run("marc with filters", func(t *testing.T) {
+		rr := get("/books/export?format=marc&genre=Fantasy", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "application/marc", rr.Header().Get("Content-Type"))
+
+		rd := marc.NewReader(rr.Body)
+		r, err := rd.Read()
+		require.NoError(t, err)
+		assert.Equal(t, "Houghton Mifflin", marc.ToBook(r).PublisherID)
+		_, err = rd.Read()
+		assert.Equal(t, io.EOF, err)
+
+		rr = get("/books/export?genre=Classics", "application/marc")
+		assert.Equal(t, "application/marc", rr.Header().Get("Content-Type"))
+	})
+
+	t.Run("marc refuses records too long for ISO 2709", func(t *testing.T) {
+		rr := get("/books/export?format=marc&genre=Reference", "")
+		require.Equal(t, http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+		var body map[string]string
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+		assert.Contains(t, body["error"], "book 5:")
+		assert.Contains(t, body["error"], "format=marcxml")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, get("/books/5?format=marc", "").Code)
+
+		// A description longer than one field still fits when split.
+		rr = get("/books/4?format=marc", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		r, err := marc.Unmarshal(rr.Body.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "Summa", marc.ToBook(r).Title)
+		assert.Len(t, r.All("520", 'a'), 2)
+
+		// MARCXML has no length limit.
+		rr = get("/books/export?format=marcxml&genre=Reference", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		records, err := marc.ReadXML(rr.Body)
+		require.NoError(t, err)
+		assert.Len(t, records, 2)
+	})
+
+	t.Run("single book", func(t *testing.T) {
+		rr := get("/books/2?format=marcxml", "")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		records, err := marc.ReadXML(rr.Body)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Emma"}, titles(records))
+		etag := rr.Header().Get("ETag")
+		assert.Contains(t, etag, "-marcxml")
+
+		rr = get("/books/2", "application/marc")
+		require.Equal(t, http.StatusOK, rr.Code)
+		r, err := marc.Unmarshal(rr.Body.Bytes())
+		require.NoError(t, err)
+		assert.Equal(t, "2", r.Control("001"))
+
+		rr = get("/books/2", "application/json, application/marc;q=0.5")
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		// Types a single book has no form for fall back to JSON, as before
+		// MARC was added.
+		for _, accept := range []string{"text/csv", "application/xml", "text/html"} {
+			rr = get("/books/2?fields=title", accept)
+			require.Equal(t, http.StatusOK, rr.Code, accept)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"), accept)
+			assert.JSONEq(t, `{"title": "Emma"}`, rr.Body.String(), accept)
+		}
+
+		req := httptest.NewRequest("GET", "/books/2?format=marcxml", nil)
+		req.Header.Set("If-None-Match", etag)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		for _, tc := range []struct {
+			target, accept string
+			code           int
+		}{
+			{"/books/export?format=json", "", http.StatusNotAcceptable},
+			{"/books/export", "text/csv", http.StatusNotAcceptable},
+			{"/books/export?minPrice=cheap", "", http.StatusBadRequest},
+			{"/books/2?format=csv", "", http.StatusNotAcceptable},
+			{"/books/nope?format=marc", "", http.StatusNotFound},
+			{"/books/2?format=marcxml&fields=title", "", http.StatusBadRequest},
+			{"/books/2?exclude=isbn", "application/marc", http.StatusBadRequest},
+		} {
+			rr := get(tc.target, tc.accept)
+			assert.Equal(t, tc.code, rr.Code, tc.target)
+		}
+		rr := get("/books/export", "text/csv")
+		assert.Contains(t, rr.Body.String(), "application/marcxml+xml, application/marc")
+		rr = get("/books/2?format=marc&fields=title", "")
+		assert.Contains(t, rr.Body.String(), "fields and exclude only apply to JSON, not marc")
+	})
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"book-api/models"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// bookFields are the JSON names of models.Book in declaration order, the
+// order shaped responses keep.
+var bookFields = func() []string {
+	t := reflect.TypeOf(models.Book{})
+	fields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+	}
+	return fields
+}()
+
+// fieldSet is the subset of bookFields a response carries; nil means all.
+type fieldSet []string
+
+// parseFieldSet reads fields, the fields to keep, and exclude, the fields to
+// drop. Both may be given; exclude then drops from what fields keeps.
+func parseFieldSet(q url.Values) (fieldSet, error) {
+	include, err := fieldListParam(q, "fields")
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := fieldListParam(q, "exclude")
+	if err != nil {
+		return nil, err
+	}
+	if include == nil && exclude == nil {
+		return nil, nil
+	}
+
+	fs := fieldSet{}
+	for _, field := range bookFields {
+		if (include == nil || include[field]) && !exclude[field] {
+			fs = append(fs, field)
+		}
+	}
+	return fs, nil
+}
+
+func fieldListParam(q url.Values, name string) (map[string]bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	known := make(map[string]bool, len(bookFields))
+	for _, field := range bookFields {
+		known[field] = true
+	}
+	fields := map[string]bool{}
+	for _, field := range strings.Split(v, ",") {
+		field = strings.TrimSpace(field)
+		if !known[field] {
+			return nil, &queryError{name, v, fmt.Sprintf("unknown field %q; allowed fields are %s", field, strings.Join(bookFields, ", "))}
+		}
+		fields[field] = true
+	}
+	return fields, nil
+}
+
+// shapedBook encodes only the fields of a fieldSet, in bookFields order.
+type shapedBook struct {
+	book   *models.Book
+	fields fieldSet
+}
+
+func (s shapedBook) MarshalJSON() ([]byte, error) {
+	values, err := s.fields.values(s.book)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range s.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(values[i])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// names returns the fields fs keeps, all of bookFields when fs is nil.
+func (fs fieldSet) names() []string {
+	if fs == nil {
+		return bookFields
+	}
+	return fs
+}
+
+// values returns the JSON encoding of each of fs.names() for book.
+func (fs fieldSet) values(book *models.Book) ([]json.RawMessage, error) {
+	data, err := json.Marshal(book)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	names := fs.names()
+	values := make([]json.RawMessage, len(names))
+	for i, name := range names {
+		values[i] = all[name]
+	}
+	return values, nil
+}
+
+// shape returns book itself when fs is nil, so unshaped responses encode
+// exactly as before.
+func (fs fieldSet) shape(book *models.Book) interface{} {
+	if fs == nil {
+		return book
+	}
+	return shapedBook{book, fs}
+}
+
+// shapeAll never returns a nil slice, which some repositories give for an
+// empty catalog, so lists always encode as an array.
+func (fs fieldSet) shapeAll(books []*models.Book) interface{} {
+	if books == nil {
+		books = []*models.Book{}
+	}
+	if fs == nil {
+		return books
+	}
+	shaped := make([]shapedBook, len(books))
+	for i, book := range books {
+		shaped[i] = shapedBook{book, fs}
+	}
+	return shaped
+}
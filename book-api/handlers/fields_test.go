@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"book-api/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookHandler_SparseFieldsets(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Dune", ISBN: "111", Price: 9.5, Description: "A very long description"},
+		&models.Book{BookID: "2", Title: "Emma", ISBN: "222", Price: 4, Description: "Another one"},
+	)
+	handler := NewBookHandler(repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/books", handler.GetBooks)
+	router.HandleFunc("/books/{id}", handler.GetBook)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("GET", target, nil))
+		return rr
+	}
+
+	t.Run("fields keep book order", func(t *testing.T) {
+		rr := get("/books/1?fields=price,title,isbn")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"title":"Dune","isbn":"111","price":9.5}`, rr.Body.String())
+		assert.Contains(t, rr.Body.String(), `{"title":"Dune","isbn":"111","price":9.5}`)
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		rr := get("/books/1?exclude=description")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "description")
+		assert.Contains(t, rr.Body.String(), `"bookId":"1"`)
+		assert.Contains(t, rr.Body.String(), `"version":1`)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rr := get("/books?fields=bookId,title&exclude=bookId&limit=1")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"data":[{"title":"Dune"}]`)
+		assert.Contains(t, rr.Body.String(), `"total":2`)
+	})
+
+	t.Run("cursor survives a change of fields", func(t *testing.T) {
+		rr := get("/books?limit=1&fields=title")
+		require.Equal(t, http.StatusOK, rr.Code)
+		link := rr.Header().Get("Link")
+		require.Contains(t, link, `rel="next"`)
+
+		next, err := url.Parse(link[1 : len(link)-len(`>; rel="next"`)])
+		require.NoError(t, err)
+		q := next.Query()
+		q.Set("fields", "isbn")
+		rr = get(next.Path + "?" + q.Encode())
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"data":[{"isbn":"222"}]`)
+	})
+
+	t.Run("unknown fields list the allowed ones", func(t *testing.T) {
+		for _, target := range []string{"/books?fields=title,summary", "/books/1?exclude=descripton", "/books?fields=title,"} {
+			rr := get(target)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, target)
+			assert.Contains(t, rr.Body.String(), "allowed fields are bookId, authorId", target)
+		}
+	})
+}
+
+func TestSearchSparseFieldsets(t *testing.T) {
+	handler := NewSearchHandler(newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Dune", ISBN: "111", Description: "Spice"},
+	))
+
+	rr := httptest.NewRecorder()
+	handler.ExecuteBookSearch(rr, httptest.NewRequest("GET", "/books/search?q=dune&fields=title,isbn", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[{"title":"Dune","isbn":"111"}]`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	handler.ExecuteBookSearch(rr, httptest.NewRequest("GET", "/books/search?q=dune&exclude=spice", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
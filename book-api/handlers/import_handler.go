@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"book-api/importer"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const maxImportSize = 10 << 20
+
+// importReport is the body of POST /books/import: the count of each action
+// and the line-numbered outcome of every record.
+type importReport struct {
+	DryRun  bool   `json:"dryRun"`
+	Format  string `json:"format"`
+	Profile string `json:"profile,omitempty"`
+	importer.Summary
+	Results []importer.Result `json:"results"`
+}
+
+// ImportBooks merges a catalog into the repository: CSV mapped to books by a
+// profile, or ONIX 3.0 XML. Records are checked like CreateBook and
+// UpdateBook and then created, updated or rejected one by one. With dryRun
+// nothing is written and the report shows what would happen.
+func (h *BookHandler) ImportBooks(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun := false
+	if v := q.Get("dryRun"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			respondWithError(w, http.StatusBadRequest, (&queryError{"dryRun", v, "must be true or false"}).Error())
+			return
+		}
+	}
+	report := importReport{DryRun: dryRun}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	var rows []importer.Row
+	var err error
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "text/csv":
+		var profile importer.Profile
+		if report.Profile, profile, err = h.importProfile(q); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		report.Format = "csv"
+		rows, err = importer.ReadCSV(body, profile)
+	case "application/xml", "text/xml":
+		report.Format = "onix"
+		rows, err = importer.ReadONIX(body)
+	default:
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be text/csv, or application/xml for ONIX 3.0")
+		return
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondWithError(w, http.StatusRequestEntityTooLarge, "the file is larger than 10 MiB")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusBadRequest, "invalid "+report.Format+": "+err.Error())
+		return
+	case len(rows) == 0:
+		respondWithError(w, http.StatusBadRequest, "the file has no records")
+		return
+	}
+
+	books, err := h.repo.GetAllBooks(r.Context())
+	if err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+	report.Results = importer.Plan(books, rows)
+	if !dryRun {
+		if err := importer.Apply(r.Context(), h.repo, report.Results); err != nil {
+			respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+	}
+
+	report.Summary = importer.Summarize(report.Results)
+	respondWithJSON(w, http.StatusOK, report)
+}
+
+// importProfile resolves the profile parameter, a custom profile shadowing a
+// built-in one of the same name, and applies the map.<field>=<column> and
+// default.<field>=<value> overrides of the request.
+func (h *BookHandler) importProfile(q url.Values) (string, importer.Profile, error) {
+	name := q.Get("profile")
+	if name == "" {
+		name = "default"
+	}
+	profile, ok := h.ImportProfiles[name]
+	if !ok {
+		profile, ok = importer.Profiles[name]
+	}
+	if !ok {
+		names := importer.ProfileNames(importer.Profiles)
+		for custom := range h.ImportProfiles {
+			if _, builtIn := importer.Profiles[custom]; !builtIn {
+				names = append(names, custom)
+			}
+		}
+		return "", profile, &queryError{"profile", name, "unknown profile; profiles are " + strings.Join(names, ", ")}
+	}
+
+	columns, defaults := map[string]string{}, map[string]string{}
+	for key := range q {
+		if field, ok := strings.CutPrefix(key, "map."); ok {
+			columns[field] = q.Get(key)
+		} else if field, ok := strings.CutPrefix(key, "default."); ok {
+			defaults[field] = q.Get(key)
+		}
+	}
+	profile = profile.With(columns, defaults)
+	if err := profile.Validate(); err != nil {
+		return "", profile, &queryError{"profile", name, err.Error()}
+	}
+	return name, profile, nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"book-api/importer"
+	"book-api/models"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookHandler_ImportBooks(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Dune", AuthorID: "a", PublisherID: "p", ISBN: "111", Pages: 500, Price: 9},
+	)
+	handler := NewBookHandler(repo)
+
+	send := func(query, contentType, body string) (*httptest.ResponseRecorder, importReport) {
+		r := httptest.NewRequest("POST", "/books/import?"+query, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		handler.ImportBooks(rr, r)
+		var report importReport
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &report))
+		}
+		return rr, report
+	}
+	count := func() int {
+		books, err := repo.GetAllBooks(context.Background())
+		require.NoError(t, err)
+		return len(books)
+	}
+
+	csv := "title,authorId,publisherId,isbn,pages,price\n" +
+		"Emma,Austen,Penguin,222,300,5\n" +
+		"Dune,Herbert,Ace,111,500,9.99\n" +
+		"Broken,,,333,-1,0\n"
+
+	t.Run("dry run", func(t *testing.T) {
+		rr, report := send("dryRun=true", "text/csv; charset=utf-8", csv)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.True(t, report.DryRun)
+		assert.Equal(t, "default", report.Profile)
+		assert.Equal(t, []int{1, 1, 0, 1}, []int{report.Created, report.Updated, report.Unchanged, report.Rejected})
+
+		require.Len(t, report.Results, 3)
+		assert.Equal(t, 2, report.Results[0].Line)
+		assert.Equal(t, importer.Create, report.Results[0].Action)
+		assert.Empty(t, report.Results[0].BookID)
+		assert.Equal(t, "1", report.Results[1].BookID)
+		assert.Equal(t, 4, report.Results[2].Line)
+		assert.Contains(t, report.Results[2].Errors, "authorId is required")
+		assert.Contains(t, report.Results[2].Errors, "pages must be positive")
+
+		assert.Equal(t, 1, count())
+		book, err := repo.GetBookByID(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, 9.0, book.Price)
+	})
+
+	t.Run("import", func(t *testing.T) {
+		rr, report := send("", "text/csv", csv)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.False(t, report.DryRun)
+		assert.Equal(t, []int{1, 1, 0, 1}, []int{report.Created, report.Updated, report.Unchanged, report.Rejected})
+		assert.NotEmpty(t, report.Results[0].BookID)
+
+		assert.Equal(t, 2, count())
+		created, err := repo.GetBookByID(context.Background(), report.Results[0].BookID)
+		require.NoError(t, err)
+		assert.Equal(t, "Emma", created.Title)
+		book, err := repo.GetBookByID(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, 9.99, book.Price)
+		assert.Equal(t, "Herbert", book.AuthorID)
+		assert.Equal(t, int64(2), book.Version)
+
+		_, report = send("", "text/csv", csv)
+		assert.Equal(t, []int{0, 0, 2, 1}, []int{report.Created, report.Updated, report.Unchanged, report.Rejected})
+	})
+
+	t.Run("goodreads with overrides", func(t *testing.T) {
+		export := "Title,Author,Publisher,ISBN,ISBN13,Number of Pages,Year Published,Exclusive Shelf\n" +
+			`The Hobbit,J.R.R. Tolkien,Houghton Mifflin,"=""0618260307""","=""9780618260300""",366,2002,read` + "\n"
+		rr, report := send("profile=goodreads&default.price=12.5&map.genre=Exclusive+Shelf", "text/csv", export)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, report.Created, report.Results)
+
+		book, err := repo.GetBookByID(context.Background(), report.Results[0].BookID)
+		require.NoError(t, err)
+		assert.Equal(t, "9780618260300", book.ISBN)
+		assert.Equal(t, 12.5, book.Price)
+		assert.Equal(t, "read", book.Genre)
+		assert.Equal(t, "2002", book.PublicationDate)
+	})
+
+	t.Run("goodreads export", func(t *testing.T) {
+		// The header of a Goodreads library export, which has no price.
+		export := "Book Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Bookshelves,Bookshelves with positions,Exclusive Shelf,My Review,Spoiler,Private Notes,Read Count,Owned Copies\n" +
+			`2767052,"The Hunger Games (The Hunger Games, #1)",Suzanne Collins,"Collins, Suzanne",,"=""0439023483""","=""9780439023481""",5,4.33,Scholastic Press,Hardcover,374,2008,2008,,2015/01/03,,,read,,,,1,1` + "\n"
+
+		before := count()
+		rr, _ := send("profile=goodreads", "text/csv", export)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "the export has no price column; set default.price")
+		assert.Equal(t, before, count())
+
+		rr, report := send("profile=goodreads&default.price=7", "text/csv", export)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, report.Created, report.Results)
+		book, err := repo.GetBookByID(context.Background(), report.Results[0].BookID)
+		require.NoError(t, err)
+		assert.Equal(t, 7.0, book.Price)
+		assert.Equal(t, "9780439023481", book.ISBN)
+	})
+
+	t.Run("custom profile", func(t *testing.T) {
+		handler.ImportProfiles = map[string]importer.Profile{
+			"shop": {Columns: map[string][]string{"title": {"Name"}, "isbn": {"EAN"}}},
+		}
+		defer func() { handler.ImportProfiles = nil }()
+
+		rr, report := send("profile=shop&dryRun=1", "text/csv", "Name,EAN\nDune Messiah,111\n")
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, importer.Update, report.Results[0].Action)
+
+		rr, _ = send("profile=nope", "text/csv", "Name,EAN\nDune,111\n")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "goodreads, librarything, shop")
+	})
+
+	t.Run("onix", func(t *testing.T) {
+		catalog, err := os.ReadFile("../importer/testdata/onix/catalog.xml")
+		require.NoError(t, err)
+
+		rr, report := send("dryRun=true", "application/xml", string(catalog))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, "onix", report.Format)
+		assert.Empty(t, report.Profile)
+		// The Hobbit came in with the goodreads export.
+		assert.Equal(t, []int{1, 1, 0, 3}, []int{report.Created, report.Updated, report.Unchanged, report.Rejected})
+		assert.Equal(t, 232, report.Results[3].Line)
+		assert.Equal(t, "com.example.obsolete", report.Results[3].Record)
+
+		before := count()
+		rr, report = send("", "text/xml; charset=utf-8", string(catalog))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		assert.Equal(t, before+1, count())
+		book, err := repo.GetBookByID(context.Background(), report.Results[0].BookID)
+		require.NoError(t, err)
+		assert.Equal(t, "The Hobbit: Or There and Back Again", book.Title)
+		assert.Equal(t, 150, book.Quantity)
+
+		rr, _ = send("", "application/xml", `<ONIXMessage release="2.1"/>`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "invalid onix: ONIX release 2.1")
+		rr, _ = send("", "application/xml", `<ONIXMessage release="3.0"></ONIXMessage>`)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		rr, _ := send("", "application/json", csv)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+
+		for _, tc := range []struct{ query, body string }{
+			{"dryRun=maybe", csv},
+			{"map.colour=Colour", csv},
+			{"", "colour,size\nred,1\n"},
+			{"", "title\n"},
+			{"", "title\n\"unterminated\n"},
+		} {
+			rr, _ := send(tc.query, "text/csv", tc.body)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, tc.query+" "+tc.body)
+		}
+
+		rr, _ = send("", "text/csv", "title\n"+strings.Repeat("x", maxImportSize))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"book-api/models"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// responseFormat is one representation of a book list.
+type responseFormat struct {
+	// name is the value of ?format= that selects the format.
+	name        string
+	contentType string
+	// mediaTypes are the Accept values the format answers to.
+	mediaTypes []string
+	encode     func(w io.Writer, list bookList) error
+}
+
+// bookList is a list response independent of its format: the books, the
+// fields each carries and, for GET /books, the page it is.
+type bookList struct {
+	books  []*models.Book
+	fields fieldSet
+	page   *pageInfo
+}
+
+type pageInfo struct {
+	total, limit, offset int
+	next, prev           string
+}
+
+// responseFormats in order of preference: the first acceptable one wins when
+// the client rates several equally, and JSON is sent when there is no Accept.
+var responseFormats = []*responseFormat{
+	{name: "json", contentType: "application/json", mediaTypes: []string{"application/json"}, encode: encodeJSON},
+	{name: "csv", contentType: "text/csv; charset=utf-8", mediaTypes: []string{"text/csv"}, encode: encodeCSV},
+	{name: "xml", contentType: "application/xml; charset=utf-8", mediaTypes: []string{"application/xml", "text/xml"}, encode: encodeXML},
+	{name: "yaml", contentType: "application/yaml", mediaTypes: []string{"application/yaml", "application/x-yaml", "text/yaml"}, encode: encodeYAML},
+}
+
+// errNotAcceptable lists what can be sent instead, for the 406 body.
+var errNotAcceptable = notAcceptable(responseFormats)
+
+func notAcceptable(formats []*responseFormat) error {
+	var types []string
+	for _, f := range formats {
+		types = append(types, f.mediaTypes...)
+	}
+	return fmt.Errorf("none of the requested formats are available; supported media types are %s", strings.Join(types, ", "))
+}
+
+// negotiateFormat picks the format of a book list from ?format=, or else
+// from the Accept header, and marks the response as varying by Accept.
+func negotiateFormat(w http.ResponseWriter, r *http.Request) (*responseFormat, error) {
+	return negotiate(w, r, responseFormats, errNotAcceptable)
+}
+
+// negotiate picks one of formats as negotiateFormat does, answering unmet
+// requests with unmet.
+func negotiate(w http.ResponseWriter, r *http.Request, formats []*responseFormat, unmet error) (*responseFormat, error) {
+	w.Header().Add("Vary", "Accept")
+
+	if name := r.URL.Query().Get("format"); name != "" {
+		for _, f := range formats {
+			if strings.EqualFold(f.name, name) {
+				return f, nil
+			}
+		}
+		return nil, unmet
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return formats[0], nil
+	}
+	ranges := parseAccept(accept)
+
+	var best *responseFormat
+	bestQ := 0.0
+	for _, f := range formats {
+		if q := f.quality(ranges); q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	if best == nil {
+		return nil, unmet
+	}
+	return best, nil
+}
+
+type mediaRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept reads the media ranges of an Accept header, skipping malformed
+// ones rather than failing the request.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType, q})
+	}
+	return ranges
+}
+
+// quality is the weight the client gives f: that of the most specific range
+// matching one of f's media types, so "text/csv;q=0, */*" rules CSV out.
+func (f *responseFormat) quality(ranges []mediaRange) float64 {
+	q, specificity := 0.0, -1
+	for _, mediaType := range f.mediaTypes {
+		for _, r := range ranges {
+			if s := matchMediaRange(r.mediaType, mediaType); s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+	}
+	return q
+}
+
+// matchMediaRange returns how specifically pattern matches mediaType: 2 for
+// an exact match, 1 for type/*, 0 for */* and -1 for no match.
+func matchMediaRange(pattern, mediaType string) int {
+	switch {
+	case pattern == mediaType:
+		return 2
+	case pattern == "*/*":
+		return 0
+	case strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")):
+		return 1
+	default:
+		return -1
+	}
+}
+
+// etag derives the entity tag of f's representation from the JSON one, since
+// the formats share a URL.
+func (f *responseFormat) etag(tag string) string {
+	if f == responseFormats[0] {
+		return tag
+	}
+	return strings.TrimSuffix(tag, `"`) + "-" + f.name + `"`
+}
+
+// respondWithBooks encodes list in format. A page also reports its total in
+// X-Total-Count, where formats without an envelope can find it.
+func respondWithBooks(w http.ResponseWriter, code int, format *responseFormat, list bookList) {
+	var buf bytes.Buffer
+	if err := format.encode(&buf, list); err != nil {
+		respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	if list.page != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(list.page.total))
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
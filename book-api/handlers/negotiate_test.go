@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"book-api/models"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		name, accept, format string
+		want                 string
+	}{
+		{name: "no accept", want: "json"},
+		{name: "anything", accept: "*/*", want: "json"},
+		{name: "csv", accept: "text/csv", want: "csv"},
+		{name: "text xml", accept: "text/xml", want: "xml"},
+		{name: "yaml alias", accept: "application/x-yaml", want: "yaml"},
+		{name: "highest quality", accept: "application/json;q=0.5, application/xml;q=0.9", want: "xml"},
+		{name: "specific range overrides wildcard", accept: "application/json;q=0, */*", want: "csv"},
+		{name: "type wildcard", accept: "text/*", want: "csv"},
+		{name: "browser", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", want: "xml"},
+		{name: "malformed ranges are skipped", accept: "nonsense, text/csv;q=2, application/yaml", want: "yaml"},
+		{name: "format overrides accept", accept: "text/csv", format: "YAML", want: "yaml"},
+		{name: "unsupported", accept: "text/html"},
+		{name: "everything refused", accept: "*/*;q=0"},
+		{name: "unknown format", format: "pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := "/books"
+			if tt.format != "" {
+				target += "?format=" + tt.format
+			}
+			r := httptest.NewRequest("GET", target, nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			format, err := negotiateFormat(w, r)
+			assert.Equal(t, "Accept", w.Header().Get("Vary"))
+			if tt.want == "" {
+				assert.ErrorIs(t, err, errNotAcceptable)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, format.name)
+		})
+	}
+}
+
+func TestBookHandler_GetBooksFormats(t *testing.T) {
+	created := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: `Dune, "Special" Edition`, ISBN: "111", Price: 9.5, CreatedAt: created},
+		&models.Book{BookID: "2", Title: "Emma & <Co>", ISBN: "222", Price: 4, CreatedAt: created.Add(time.Hour)},
+	)
+	handler := NewBookHandler(repo)
+
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		rr := httptest.NewRecorder()
+		handler.GetBooks(rr, r)
+		return rr
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		rr := get("/books?fields=bookId,title,price", "text/csv")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "2", rr.Header().Get("X-Total-Count"))
+
+		rows, err := csv.NewReader(rr.Body).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"bookId", "title", "price"},
+			{"1", `Dune, "Special" Edition`, "9.5"},
+			{"2", "Emma & <Co>", "4"},
+		}, rows)
+	})
+
+	t.Run("csv neutralises formulas", func(t *testing.T) {
+		repo := newTestRepository(t,
+			&models.Book{BookID: "1", Title: "=HYPERLINK(\"http://evil\")", ISBN: "111"},
+			&models.Book{BookID: "2", Title: "+1", Genre: "-2", Description: "@SUM(A1)", ISBN: "222"},
+			&models.Book{BookID: "3", Title: "\tTab", Genre: "Plain = fine", ISBN: "333", Price: -1},
+		)
+		rr := httptest.NewRecorder()
+		NewBookHandler(repo).GetBooks(rr, httptest.NewRequest("GET", "/books?format=csv&fields=title,genre,description,price", nil))
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		rows, err := csv.NewReader(rr.Body).ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{
+			{"title", "genre", "description", "price"},
+			{`'=HYPERLINK("http://evil")`, "", "", "0"},
+			{"'+1", "'-2", "'@SUM(A1)", "0"},
+			{"'\tTab", "Plain = fine", "", "-1"},
+		}, rows)
+	})
+
+	t.Run("csv has every field by default", func(t *testing.T) {
+		rr := get("/books?format=csv&limit=1", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		rows, err := csv.NewReader(rr.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, bookFields, rows[0])
+		assert.Contains(t, rows[1], "2025-01-02T03:04:05Z")
+		assert.Contains(t, rr.Header().Get("Link"), "format=csv")
+	})
+
+	t.Run("xml", func(t *testing.T) {
+		rr := get("/books?limit=1&fields=title,isbn", "application/xml")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/xml; charset=utf-8", rr.Header().Get("Content-Type"))
+
+		var doc struct {
+			Total int    `xml:"total,attr"`
+			Next  string `xml:"next,attr"`
+			Books []struct {
+				Title string `xml:"title"`
+				ISBN  string `xml:"isbn"`
+			} `xml:"book"`
+		}
+		require.NoError(t, xml.Unmarshal(rr.Body.Bytes(), &doc), rr.Body.String())
+		assert.Equal(t, 2, doc.Total)
+		assert.NotEmpty(t, doc.Next)
+		require.Len(t, doc.Books, 1)
+		assert.Equal(t, `Dune, "Special" Edition`, doc.Books[0].Title)
+		assert.Equal(t, "111", doc.Books[0].ISBN)
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		rr := get("/books?fields=bookId,title,price", "application/yaml")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/yaml", rr.Header().Get("Content-Type"))
+		assert.Equal(t, strings.Join([]string{
+			`data:`,
+			`  - bookId: "1"`,
+			`    title: "Dune, \"Special\" Edition"`,
+			`    price: 9.5`,
+			`  - bookId: "2"`,
+			`    title: "Emma & <Co>"`,
+			`    price: 4`,
+			`limit: 10`,
+			`next: null`,
+			`offset: 0`,
+			`prev: null`,
+			`total: 2`,
+			``,
+		}, "\n"), rr.Body.String())
+	})
+
+	t.Run("yaml of an empty page", func(t *testing.T) {
+		rr := get("/books?format=yaml&genre=none", "")
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "data: []\n")
+	})
+
+	t.Run("not acceptable", func(t *testing.T) {
+		rr := get("/books", "text/html")
+		assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "text/csv")
+	})
+
+	t.Run("each format has its own etag", func(t *testing.T) {
+		jsonTag := get("/books", "").Header().Get("ETag")
+		csvTag := get("/books", "text/csv").Header().Get("ETag")
+		assert.NotEqual(t, jsonTag, csvTag)
+
+		r := httptest.NewRequest("GET", "/books", nil)
+		r.Header.Set("Accept", "text/csv")
+		r.Header.Set("If-None-Match", jsonTag)
+		rr := httptest.NewRecorder()
+		handler.GetBooks(rr, r)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		r.Header.Set("If-None-Match", csvTag)
+		rr = httptest.NewRecorder()
+		handler.GetBooks(rr, r)
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+	})
+}
+
+func TestEncodeYAMLQuoting(t *testing.T) {
+	tricky := []string{
+		"yes", "no", "on", "null", "~", "true", "0x1F", "1e3", "",
+		"key: value", "trailing:", "- item", "-", "# comment", "a #b",
+		"&anchor", "*alias", "!tag", "[flow]", "{flow}", "'single'", `"double"`, "%TAG", "@at", "`tick`",
+		"  padded  ", "line one\nline two\n", "tab\tand \\ backslash", "Café ☕",
+	}
+	var books []*models.Book
+	for i, s := range tricky {
+		books = append(books, &models.Book{BookID: s, Title: s, Description: s, Price: float64(i) + 0.5})
+	}
+	fields, err := parseFieldSet(url.Values{"fields": {"bookId,title,description,price"}})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, encodeYAML(&buf, bookList{books: books, fields: fields}))
+
+	var got []struct {
+		BookID      *string  `yaml:"bookId"`
+		Title       *string  `yaml:"title"`
+		Description *string  `yaml:"description"`
+		Price       *float64 `yaml:"price"`
+	}
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &got), buf.String())
+	require.Len(t, got, len(tricky))
+	for i, s := range tricky {
+		require.NotNil(t, got[i].Title, s)
+		assert.Equal(t, s, *got[i].BookID)
+		assert.Equal(t, s, *got[i].Title)
+		assert.Equal(t, s, *got[i].Description)
+		assert.Equal(t, float64(i)+0.5, *got[i].Price)
+	}
+}
+
+func TestSearchFormats(t *testing.T) {
+	handler := NewSearchHandler(newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Dune", ISBN: "111"},
+	))
+
+	search := func(target, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		handler.ExecuteBookSearch(rr, r)
+		return rr
+	}
+
+	rr := search("/books/search?q=dune&fields=bookId,title", "text/csv")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "bookId,title\n1,Dune\n", rr.Body.String())
+	assert.Equal(t, "1", rr.Header().Get("X-Total-Count"))
+
+	rr = search("/books/search?q=dune&fields=title", "application/yaml")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "- title: \"Dune\"\n", rr.Body.String())
+
+	rr = search("/books/search?q=dune&fields=title", "text/xml")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "<books>\n  <book>\n    <title>Dune</title>\n  </book>\n</books>")
+
+	rr = search("/books/search?q=dune", "image/png")
+	assert.Equal(t, http.StatusNotAcceptable, rr.Code)
+}
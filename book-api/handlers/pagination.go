@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"book-api/models"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 10
+	// DefaultMaxPageSize caps limit when a handler's MaxPageSize is unset.
+	DefaultMaxPageSize = 100
+)
+
+// pageRequest is the limit and the starting point of one page: an offset, or
+// a cursor from a previous page.
+type pageRequest struct {
+	limit  int
+	offset int
+	cursor *cursor
+}
+
+// cursor marks the book a page continues from. Key holds that book's sort
+// fields and ID, so the next page starts after it wherever it is now, even if
+// books were added or removed in between. Query ties the cursor to the
+// filters and sort it was issued for.
+type cursor struct {
+	Query  string                 `json:"q"`
+	Before bool                   `json:"b,omitempty"`
+	Key    map[string]interface{} `json:"k"`
+}
+
+func maxPageSize(configured int) int {
+	if configured > 0 {
+		return configured
+	}
+	return DefaultMaxPageSize
+}
+
+// getPaginationParams reads limit, offset and cursor. limit defaults to
+// defaultLimit and is capped at maxLimit rather than rejected.
+func getPaginationParams(r *http.Request, defaultLimit, maxLimit int) (pageRequest, error) {
+	q := r.URL.Query()
+	req := pageRequest{limit: defaultLimit}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return req, &queryError{"limit", v, "must be a positive integer"}
+		}
+		req.limit = limit
+	}
+	if req.limit > maxLimit {
+		req.limit = maxLimit
+	}
+
+	if v := q.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return req, &queryError{"offset", v, "must be a non-negative integer"}
+		}
+		req.offset = offset
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if q.Get("offset") != "" {
+			return req, &queryError{"cursor", v, "cannot be combined with offset"}
+		}
+		c, err := decodeCursor(v)
+		if err != nil {
+			return req, &queryError{"cursor", v, "is not a valid cursor"}
+		}
+		if c.Query != queryFingerprint(q) {
+			return req, &queryError{"cursor", v, "was issued for different filters or sort"}
+		}
+		req.cursor = c
+	}
+	return req, nil
+}
+
+// pageOnlyParams select a page of a result set, or shape or encode its books,
+// without changing which books it holds or their order.
+var pageOnlyParams = map[string]bool{"limit": true, "offset": true, "cursor": true, "fields": true, "exclude": true, "format": true}
+
+// queryFingerprint identifies the result set of a query: every parameter
+// except pageOnlyParams.
+func queryFingerprint(q url.Values) string {
+	rest := url.Values{}
+	for name, values := range q {
+		if !pageOnlyParams[name] {
+			rest[name] = values
+		}
+	}
+	sum := sha256.Sum256([]byte(rest.Encode()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func encodeCursor(c cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if _, ok := c.Key["bookId"].(string); !ok {
+		return nil, fmt.Errorf("cursor has no book ID")
+	}
+	return &c, nil
+}
+
+// cursorKey keeps the fields of book that its position under keys depends on.
+func cursorKey(book *models.Book, keys []sortKey) map[string]interface{} {
+	data, _ := json.Marshal(book)
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+
+	key := map[string]interface{}{"bookId": book.BookID}
+	for _, k := range keys {
+		key[k.field] = fields[k.field]
+	}
+	return key
+}
+
+// boundary turns a cursor back into a book that compares like the one it was
+// issued for.
+func (c *cursor) boundary() (*models.Book, error) {
+	data, err := json.Marshal(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	var book models.Book
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+// paginate returns one page of books, which must be sorted by keys, and the
+// cursors of the pages either side of it; a cursor is empty at either end.
+func paginate(books []*models.Book, keys []sortKey, req pageRequest, fingerprint string) (page []*models.Book, next, prev string, err error) {
+	start := req.offset
+	if req.cursor != nil {
+		boundary, err := req.cursor.boundary()
+		if err != nil {
+			return nil, "", "", &queryError{"cursor", "", "is not a valid cursor"}
+		}
+		if req.cursor.Before {
+			end := sort.Search(len(books), func(i int) bool { return compareBooks(books[i], boundary, keys) >= 0 })
+			start = end - req.limit
+			if start < 0 {
+				start = 0
+			}
+		} else {
+			start = sort.Search(len(books), func(i int) bool { return compareBooks(books[i], boundary, keys) > 0 })
+		}
+	}
+	if start > len(books) {
+		start = len(books)
+	}
+	end := start + req.limit
+	if end > len(books) {
+		end = len(books)
+	}
+	page = books[start:end]
+
+	if end < len(books) && len(page) > 0 {
+		next = encodeCursor(cursor{Query: fingerprint, Key: cursorKey(page[len(page)-1], keys)})
+	}
+	if start > 0 && len(page) > 0 {
+		prev = encodeCursor(cursor{Query: fingerprint, Before: true, Key: cursorKey(page[0], keys)})
+	}
+	return page, next, prev, nil
+}
+
+// setLinkHeader advertises the neighbouring pages as RFC 8288 links relative
+// to the request URL.
+func setLinkHeader(w http.ResponseWriter, r *http.Request, next, prev string) {
+	var links []string
+	for _, link := range []struct{ rel, cursor string }{{"next", next}, {"prev", prev}} {
+		if link.cursor == "" {
+			continue
+		}
+		q := r.URL.Query()
+		q.Del("offset")
+		q.Set("cursor", link.cursor)
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, q.Encode(), link.rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// nullable makes an empty cursor encode as JSON null.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
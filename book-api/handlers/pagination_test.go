@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"book-api/models"
+	"book-api/repository"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listResponse struct {
+	Data  []models.Book `json:"data"`
+	Total int           `json:"total"`
+	Limit int           `json:"limit"`
+	Next  *string       `json:"next"`
+	Prev  *string       `json:"prev"`
+}
+
+func seedBooks(t *testing.T, n int) *repository.MemoryBookRepository {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var books []*models.Book
+	for i := 0; i < n; i++ {
+		books = append(books, &models.Book{
+			BookID:    fmt.Sprintf("b%02d", i),
+			Title:     fmt.Sprintf("Book %02d", i),
+			ISBN:      fmt.Sprintf("isbn-%02d", i),
+			Price:     float64(i % 3),
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	return newTestRepository(t, books...)
+}
+
+func TestBookHandler_CursorPagination(t *testing.T) {
+	repo := seedBooks(t, 7)
+	handler := NewBookHandler(repo)
+
+	list := func(query string) (*httptest.ResponseRecorder, listResponse) {
+		rr := httptest.NewRecorder()
+		handler.GetBooks(rr, httptest.NewRequest("GET", "/books?"+query, nil))
+		var resp listResponse
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		}
+		return rr, resp
+	}
+	ids := func(resp listResponse) []string {
+		var out []string
+		for _, book := range resp.Data {
+			out = append(out, book.BookID)
+		}
+		return out
+	}
+
+	t.Run("walks every page once", func(t *testing.T) {
+		var seen []string
+		query := "limit=3&sort=-price"
+		for pages := 0; ; pages++ {
+			require.Less(t, pages, 5)
+			rr, resp := list(query)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			seen = append(seen, ids(resp)...)
+			if resp.Next == nil {
+				assert.NotContains(t, rr.Header().Get("Link"), `rel="next"`)
+				break
+			}
+			assert.Contains(t, rr.Header().Get("Link"), `rel="next"`)
+			query = "limit=3&sort=-price&cursor=" + url.QueryEscape(*resp.Next)
+		}
+		assert.Equal(t, []string{"b02", "b05", "b01", "b04", "b00", "b03", "b06"}, seen)
+	})
+
+	t.Run("survives inserts and deletes between pages", func(t *testing.T) {
+		_, first := list("limit=3")
+		require.Equal(t, []string{"b00", "b01", "b02"}, ids(first))
+		require.NotNil(t, first.Next)
+		assert.Nil(t, first.Prev)
+
+		// b00 sorts before the cursor and b02 is the cursor's own book; with
+		// offsets both would shift the next page.
+		require.NoError(t, repo.DeleteBook(context.Background(), "b00", repository.AnyVersion))
+		require.NoError(t, repo.DeleteBook(context.Background(), "b02", repository.AnyVersion))
+		require.NoError(t, repo.CreateBook(context.Background(), &models.Book{BookID: "a-new", ISBN: "new",
+			CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}))
+
+		rr, second := list("limit=3&cursor=" + url.QueryEscape(*first.Next))
+		require.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []string{"b03", "b04", "b05"}, ids(second))
+		require.NotNil(t, second.Prev)
+		assert.Contains(t, rr.Header().Get("Link"), `rel="prev"`)
+
+		_, back := list("limit=2&cursor=" + url.QueryEscape(*second.Prev))
+		assert.Equal(t, []string{"a-new", "b01"}, ids(back))
+	})
+
+	t.Run("limit is capped", func(t *testing.T) {
+		handler.MaxPageSize = 2
+		defer func() { handler.MaxPageSize = 0 }()
+		_, resp := list("limit=50")
+		assert.Equal(t, 2, resp.Limit)
+		assert.Len(t, resp.Data, 2)
+	})
+
+	t.Run("rejects bad cursors", func(t *testing.T) {
+		_, resp := list("limit=1&sort=title")
+		require.NotNil(t, resp.Next)
+		cursor := url.QueryEscape(*resp.Next)
+
+		for _, query := range []string{
+			"cursor=not-a-cursor",
+			"sort=-title&cursor=" + cursor,
+			"sort=title&offset=1&cursor=" + cursor,
+		} {
+			rr, _ := list(query)
+			assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+		}
+
+		rr, _ := list("limit=5&sort=title&cursor=" + cursor)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestSearchPagination(t *testing.T) {
+	repo := seedBooks(t, 5)
+	handler := NewSearchHandler(repo)
+	handler.MaxPageSize = 3
+
+	search := func(query string) (*httptest.ResponseRecorder, []models.Book) {
+		rr := httptest.NewRecorder()
+		handler.ExecuteBookSearch(rr, httptest.NewRequest("GET", "/books/search?"+query, nil))
+		var books []models.Book
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &books))
+		}
+		return rr, books
+	}
+
+	// Unlike GET /books, search answers with a bare array: the cursors are
+	// only in Link, and the matches cut off by the page size in X-Total-Count.
+	rr, books := search("q=book")
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, books, 3)
+	assert.Equal(t, "[", rr.Body.String()[:1])
+	assert.Equal(t, "5", rr.Header().Get("X-Total-Count"))
+	link := rr.Header().Get("Link")
+	require.Contains(t, link, `rel="next"`)
+
+	next := link[1 : len(link)-len(`>; rel="next"`)]
+	u, err := url.Parse(next)
+	require.NoError(t, err)
+	assert.Equal(t, "/books/search", u.Path)
+
+	rr, books = search(u.RawQuery)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.Len(t, books, 2)
+	assert.Equal(t, "b03", books[0].BookID)
+	assert.Equal(t, "5", rr.Header().Get("X-Total-Count"))
+	assert.Contains(t, rr.Header().Get("Link"), `rel="prev"`)
+	assert.NotContains(t, rr.Header().Get("Link"), `rel="next"`)
+
+	rr, _ = search("q=book&limit=zero")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"book-api/models"
+	"book-api/patch"
+	"book-api/repository"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+
+	maxPatchSize = 1 << 20
+	// patchRetries bounds how often a PATCH without If-Match is re-applied
+	// when another write lands between reading the book and saving it.
+	patchRetries = 3
+)
+
+// immutableFields are set by the repository; a patch may not change them.
+var immutableFields = []string{"bookId", "createdAt", "updatedAt", "version"}
+
+// PatchBook applies a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) to
+// a book, selected by Content-Type. The patched book is validated like a PUT
+// body and saved against the version it was applied to, so a concurrent
+// update is never overwritten.
+func (h *BookHandler) PatchBook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case mergePatchType:
+		apply = patch.MergePatch
+	case jsonPatchType:
+		apply = patch.JSONPatch
+	default:
+		w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+		respondWithError(w, http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Content-Type must be %s or %s", mergePatchType, jsonPatchType))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPatchSize+1))
+	if err != nil || len(body) > maxPatchSize {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ifVersion, ok := h.ifMatchVersion(w, r, id)
+	if !ok {
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		current, err := h.repo.GetBookByID(r.Context(), id)
+		if err != nil {
+			respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+		if ifVersion != repository.AnyVersion && current.Version != ifVersion {
+			respondWithError(w, http.StatusPreconditionFailed, repository.ErrVersionConflict.Error())
+			return
+		}
+
+		patched, status, err := patchBook(current, body, apply)
+		if err != nil {
+			respondWithError(w, status, err.Error())
+			return
+		}
+		if err := patched.Validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		book, err := h.repo.UpdateBook(r.Context(), id, patched, current.Version)
+		if errors.Is(err, repository.ErrVersionConflict) && ifVersion == repository.AnyVersion && attempt < patchRetries {
+			continue
+		}
+		if err != nil {
+			respondWithError(w, statusForError(err, http.StatusInternalServerError), err.Error())
+			return
+		}
+
+		w.Header().Set("ETag", bookETag(book))
+		respondWithJSON(w, http.StatusOK, book)
+		return
+	}
+}
+
+// patchBook applies body to book's JSON form and decodes the result, returning
+// the status to answer with when that fails.
+func patchBook(book *models.Book, body []byte, apply func(doc, patch []byte) ([]byte, error)) (*models.Book, int, error) {
+	doc, err := json.Marshal(book)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	out, err := apply(doc, body)
+	switch {
+	case errors.Is(err, patch.ErrInvalidPatch):
+		return nil, http.StatusBadRequest, err
+	case errors.Is(err, patch.ErrTestFailed):
+		return nil, http.StatusConflict, err
+	case err != nil:
+		return nil, http.StatusUnprocessableEntity, err
+	}
+
+	var before, after map[string]interface{}
+	if err := json.Unmarshal(doc, &before); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := json.Unmarshal(out, &after); err != nil {
+		return nil, http.StatusUnprocessableEntity, errors.New("patched document is not a book")
+	}
+	for _, field := range immutableFields {
+		if !reflect.DeepEqual(before[field], after[field]) {
+			return nil, http.StatusUnprocessableEntity, fmt.Errorf("%s cannot be changed", field)
+		}
+	}
+
+	var patched models.Book
+	dec := json.NewDecoder(bytes.NewReader(out))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&patched); err != nil {
+		return nil, http.StatusUnprocessableEntity, fmt.Errorf("patched document is not a valid book: %v", err)
+	}
+	return &patched, 0, nil
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"book-api/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookHandler_PatchBook(t *testing.T) {
+	repo := newTestRepository(t,
+		&models.Book{BookID: "1", Title: "Book 1", AuthorID: "a", PublisherID: "p", ISBN: "111", Pages: 10, Price: 5, Quantity: 3, Description: "old"},
+	)
+	handler := NewBookHandler(repo)
+	router := mux.NewRouter()
+	router.HandleFunc("/books/{id}", handler.PatchBook).Methods("PATCH")
+
+	send := func(id, contentType, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PATCH", "/books/"+id, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("merge patch", func(t *testing.T) {
+		rr := send("1", "application/merge-patch+json", `{"quantity":7,"description":null}`, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		var book models.Book
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &book))
+		assert.Equal(t, 7, book.Quantity)
+		assert.Empty(t, book.Description)
+		assert.Equal(t, "Book 1", book.Title)
+		assert.Equal(t, 10, book.Pages)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("json patch", func(t *testing.T) {
+		body := `[{"op":"test","path":"/title","value":"Book 1"},{"op":"replace","path":"/title","value":"Renamed"},{"op":"copy","from":"/title","path":"/description"}]`
+		rr := send("1", "application/json-patch+json; charset=utf-8", body, map[string]string{"If-Match": `"2"`})
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		book, err := repo.GetBookByID(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", book.Title)
+		assert.Equal(t, "Renamed", book.Description)
+		assert.Equal(t, int64(3), book.Version)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		cases := []struct {
+			name, contentType, body string
+			headers                 map[string]string
+			want                    int
+		}{
+			{"unsupported content type", "application/json", `{"quantity":1}`, nil, http.StatusUnsupportedMediaType},
+			{"malformed patch", "application/json-patch+json", `{"op":"add"}`, nil, http.StatusBadRequest},
+			{"failed test", "application/json-patch+json", `[{"op":"test","path":"/title","value":"Other"}]`, nil, http.StatusConflict},
+			{"missing path", "application/json-patch+json", `[{"op":"remove","path":"/nope"}]`, nil, http.StatusUnprocessableEntity},
+			{"book id", "application/merge-patch+json", `{"bookId":"2"}`, nil, http.StatusUnprocessableEntity},
+			{"created at", "application/json-patch+json", `[{"op":"remove","path":"/createdAt"}]`, nil, http.StatusUnprocessableEntity},
+			{"version", "application/merge-patch+json", `{"version":9}`, nil, http.StatusUnprocessableEntity},
+			{"unknown field", "application/merge-patch+json", `{"titel":"typo"}`, nil, http.StatusUnprocessableEntity},
+			{"wrong type", "application/merge-patch+json", `{"pages":"many"}`, nil, http.StatusUnprocessableEntity},
+			{"fails validation", "application/merge-patch+json", `{"title":""}`, nil, http.StatusBadRequest},
+			{"stale if-match", "application/merge-patch+json", `{"quantity":1}`, map[string]string{"If-Match": `"1"`}, http.StatusPreconditionFailed},
+		}
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				rr := send("1", tc.contentType, tc.body, tc.headers)
+				assert.Equal(t, tc.want, rr.Code, rr.Body.String())
+			})
+		}
+
+		assert.Equal(t, http.StatusNotFound, send("missing", "application/merge-patch+json", `{"quantity":1}`, nil).Code)
+		assert.Contains(t, send("1", "text/plain", "", nil).Header().Get("Accept-Patch"), "application/merge-patch+json")
+
+		book, err := repo.GetBookByID(context.Background(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, "Renamed", book.Title)
+		assert.Equal(t, int64(3), book.Version)
+	})
+
+	t.Run("unchanged immutable field is allowed", func(t *testing.T) {
+		rr := send("1", "application/merge-patch+json", `{"bookId":"1","pages":11}`, nil)
+		assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("require if-match", func(t *testing.T) {
+		handler.RequireIfMatch = true
+		defer func() { handler.RequireIfMatch = false }()
+		assert.Equal(t, http.StatusPreconditionRequired, send("1", "application/merge-patch+json", `{"pages":12}`, nil).Code)
+	})
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"book-api/models"
+	"book-api/repository"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryError is an invalid query parameter, reported with 400.
+type queryError struct {
+	param, value, reason string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.param, e.value, e.reason)
+}
+
+// bookFilterParams are the filter parameters read by parseBookFilter.
+var bookFilterParams = []string{
+	"genre", "authorId", "publisherId", "minPrice", "maxPrice", "minPages", "maxPages",
+	"inStock", "publishedAfter", "publishedBefore",
+}
+
+// listParams are the parameters GET /books accepts besides its filters.
+var listParams = []string{"sort", "limit", "offset", "cursor", "fields", "exclude", "format"}
+
+// checkParams rejects any parameter that is not in one of the allowed lists,
+// naming the allowed ones.
+func checkParams(q url.Values, allowed ...[]string) error {
+	known := make(map[string]bool)
+	var names []string
+	for _, list := range allowed {
+		for _, name := range list {
+			known[name] = true
+			names = append(names, name)
+		}
+	}
+	var unknown []string
+	for name := range q {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	sort.Strings(names)
+	return &queryError{"parameter", unknown[0], "unknown parameter; allowed are " + strings.Join(names, ", ")}
+}
+
+// parseBookFilter reads the filter parameters of GET /books. Unknown values
+// are errors rather than being ignored, so a typo never widens the result.
+func parseBookFilter(q url.Values) (repository.BookFilter, error) {
+	f := repository.BookFilter{
+		Genre:       q.Get("genre"),
+		AuthorID:    q.Get("authorId"),
+		PublisherID: q.Get("publisherId"),
+	}
+
+	var err error
+	if f.MinPrice, err = floatParam(q, "minPrice"); err != nil {
+		return f, err
+	}
+	if f.MaxPrice, err = floatParam(q, "maxPrice"); err != nil {
+		return f, err
+	}
+	if f.MinPrice != nil && f.MaxPrice != nil && *f.MinPrice > *f.MaxPrice {
+		return f, &queryError{"maxPrice", q.Get("maxPrice"), "must not be less than minPrice"}
+	}
+
+	if f.MinPages, err = intParam(q, "minPages"); err != nil {
+		return f, err
+	}
+	if f.MaxPages, err = intParam(q, "maxPages"); err != nil {
+		return f, err
+	}
+	if f.MinPages != nil && f.MaxPages != nil && *f.MinPages > *f.MaxPages {
+		return f, &queryError{"maxPages", q.Get("maxPages"), "must not be less than minPages"}
+	}
+
+	if v := q.Get("inStock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, &queryError{"inStock", v, "must be true or false"}
+		}
+		f.InStock = &inStock
+	}
+
+	if f.PublishedAfter, err = dateParam(q, "publishedAfter"); err != nil {
+		return f, err
+	}
+	if f.PublishedBefore, err = dateParam(q, "publishedBefore"); err != nil {
+		return f, err
+	}
+	if f.PublishedAfter != "" && f.PublishedBefore != "" && f.PublishedAfter > f.PublishedBefore {
+		return f, &queryError{"publishedBefore", f.PublishedBefore, "must not be before publishedAfter"}
+	}
+	return f, nil
+}
+
+func floatParam(q url.Values, name string) (*float64, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		return nil, &queryError{name, v, "must be a non-negative number"}
+	}
+	return &f, nil
+}
+
+func intParam(q url.Values, name string) (*int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return nil, &queryError{name, v, "must be a non-negative integer"}
+	}
+	return &n, nil
+}
+
+// dateParam accepts YYYY-MM-DD, the format of publicationDate.
+func dateParam(q url.Values, name string) (string, error) {
+	v := q.Get(name)
+	if v == "" {
+		return "", nil
+	}
+	if _, err := time.Parse("2006-01-02", v); err != nil {
+		return "", &queryError{name, v, "must be a date like 2006-01-02"}
+	}
+	return v, nil
+}
+
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+// sortFields compares two books by one field, returning <0, 0 or >0.
+var sortFields = map[string]func(a, b *models.Book) int{
+	"title": func(a, b *models.Book) int {
+		return strings.Compare(titleCollationKey(a.Title), titleCollationKey(b.Title))
+	},
+	"authorId":    func(a, b *models.Book) int { return strings.Compare(a.AuthorID, b.AuthorID) },
+	"publisherId": func(a, b *models.Book) int { return strings.Compare(a.PublisherID, b.PublisherID) },
+	"genre": func(a, b *models.Book) int {
+		return strings.Compare(strings.ToLower(a.Genre), strings.ToLower(b.Genre))
+	},
+	"isbn":            func(a, b *models.Book) int { return strings.Compare(a.ISBN, b.ISBN) },
+	"publicationDate": func(a, b *models.Book) int { return strings.Compare(a.PublicationDate, b.PublicationDate) },
+	"price":           func(a, b *models.Book) int { return compareFloat(a.Price, b.Price) },
+	"pages":           func(a, b *models.Book) int { return a.Pages - b.Pages },
+	"quantity":        func(a, b *models.Book) int { return a.Quantity - b.Quantity },
+	"createdAt":       func(a, b *models.Book) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updatedAt":       func(a, b *models.Book) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// parseSort reads a sort parameter like "-price,title": comma-separated
+// fields, each descending when prefixed with "-".
+func parseSort(value string) ([]sortKey, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var keys []sortKey
+	for _, field := range strings.Split(value, ",") {
+		key := sortKey{field: strings.TrimSpace(field)}
+		if strings.HasPrefix(key.field, "-") {
+			key.field, key.desc = key.field[1:], true
+		}
+		if _, ok := sortFields[key.field]; !ok {
+			return nil, &queryError{"sort", value, fmt.Sprintf("unknown field %q", key.field)}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// defaultSort lists books oldest first when no sort is given.
+var defaultSort = []sortKey{{field: "createdAt"}}
+
+// sortBooks orders books by keys in turn and then by ID, so that the order is
+// total and a cursor always finds its place again.
+func sortBooks(books []*models.Book, keys []sortKey) {
+	sort.SliceStable(books, func(i, j int) bool {
+		return compareBooks(books[i], books[j], keys) < 0
+	})
+}
+
+func compareBooks(a, b *models.Book, keys []sortKey) int {
+	for _, key := range keys {
+		c := sortFields[key.field](a, b)
+		if key.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.BookID, b.BookID)
+}
+
+// leadingArticles are skipped when titles are sorted, as library catalogues
+// do: "The Hobbit" files under H.
+var leadingArticles = []string{"the ", "a ", "an "}
+
+func titleCollationKey(title string) string {
+	key := strings.ToLower(strings.TrimSpace(title))
+	for _, article := range leadingArticles {
+		if !strings.HasPrefix(key, article) {
+			continue
+		}
+		if rest := strings.TrimSpace(key[len(article):]); rest != "" {
+			return rest
+		}
+	}
+	return key
+}
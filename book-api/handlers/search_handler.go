@@ -3,9 +3,11 @@ package handlers
 import (
 	"book-api/models"
 	"book-api/repository"
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -13,6 +15,9 @@ import (
 
 type SearchHandler struct {
 	repo repository.BookRepository
+	// MaxPageSize caps limit and is also the default page size, so small
+	// result sets still come back whole; 0 means DefaultMaxPageSize.
+	MaxPageSize int
 }
 
 func NewSearchHandler(repo repository.BookRepository) *SearchHandler {
@@ -34,13 +39,29 @@ func (h *SearchHandler) ExecuteBookSearch(w http.ResponseWriter, r *http.Request
 		sendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	format, err := negotiateFormat(w, r)
+	if err != nil {
+		sendJSONError(w, http.StatusNotAcceptable, err.Error())
+		return
+	}
+	maxLimit := maxPageSize(h.MaxPageSize)
+	page, err := getPaginationParams(r, maxLimit, maxLimit)
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	fields, err := parseFieldSet(r.URL.Query())
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	// Database operation with timing and full data dump
 	dbStart := time.Now()
-	books, err := h.repo.GetAllBooks()
+	books, err := h.repo.GetAllBooks(r.Context())
 	if err != nil {
 		log.Printf("CRITICAL DATABASE ERROR: %v", err)
-		sendJSONError(w, http.StatusInternalServerError, "Database error")
+		sendJSONError(w, statusForError(err, http.StatusInternalServerError), "Database error")
 		return
 	}
 	log.Printf("Loaded %d books in %v", len(books), time.Since(dbStart))
@@ -60,8 +81,13 @@ func (h *SearchHandler) ExecuteBookSearch(w http.ResponseWriter, r *http.Request
 
 	// Perform search with detailed matching logs
 	searchStart := time.Now()
-	matchedBooks := h.searchBooks(books, query)
+	matchedBooks, err := h.searchBooks(r.Context(), books, query)
 	searchDuration := time.Since(searchStart)
+	if err != nil {
+		log.Printf("Search aborted after %v: %v", searchDuration, err)
+		sendJSONError(w, statusForError(err, http.StatusInternalServerError), "Search aborted")
+		return
+	}
 
 	log.Printf("\nSearch completed in %v", searchDuration)
 	log.Printf("Query: %q", query)
@@ -87,39 +113,56 @@ func (h *SearchHandler) ExecuteBookSearch(w http.ResponseWriter, r *http.Request
 		log.Printf("  Genre: %q", book.Genre)
 	}
 
-	sendJSONResponse(w, http.StatusOK, matchedBooks)
+	// Concurrent search returns matches in any order; pages need a fixed one.
+	sortBooks(matchedBooks, defaultSort)
+	data, next, prev, err := paginate(matchedBooks, defaultSort, page, queryFingerprint(r.URL.Query()))
+	if err != nil {
+		sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	setLinkHeader(w, r, next, prev)
+
+	// Search has always answered with a bare array, so unlike GET /books it
+	// keeps doing so and carries its cursors and total in headers only.
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(matchedBooks)))
+	respondWithBooks(w, http.StatusOK, format, bookList{books: data, fields: fields})
 	log.Printf("\n=== REQUEST COMPLETED IN %v ===\n", time.Since(dbStart))
 }
 
-func (h *SearchHandler) searchBooks(books []*models.Book, query string) []*models.Book {
+func (h *SearchHandler) searchBooks(ctx context.Context, books []*models.Book, query string) ([]*models.Book, error) {
 	if len(books) == 0 {
 		log.Printf("WARNING: Empty books list provided to search")
-		return nil
+		return nil, nil
 	}
 
 	log.Printf("Starting search with strategy selection...")
 	if len(books) < 20 {
 		log.Printf("Using simple sequential search for %d books", len(books))
-		return h.simpleSearch(books, query)
+		return h.simpleSearch(ctx, books, query)
 	}
 
 	log.Printf("Using concurrent search for %d books", len(books))
-	return h.concurrentSearch(books, query)
+	return h.concurrentSearch(ctx, books, query)
 }
 
-func (h *SearchHandler) simpleSearch(books []*models.Book, query string) []*models.Book {
+func (h *SearchHandler) simpleSearch(ctx context.Context, books []*models.Book, query string) ([]*models.Book, error) {
 	var matches []*models.Book
 	lowerQuery := strings.ToLower(query)
 
 	for _, book := range books {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if containsSearchTerm(book, lowerQuery) {
 			matches = append(matches, book)
 		}
 	}
-	return matches
+	return matches, nil
 }
 
-func (h *SearchHandler) concurrentSearch(books []*models.Book, query string) []*models.Book {
+// concurrentSearch fans chunks out to workers. Once ctx is done the workers
+// stop scanning and the collector returns without waiting for stragglers.
+func (h *SearchHandler) concurrentSearch(ctx context.Context, books []*models.Book, query string) ([]*models.Book, error) {
 	chunkSize := calculateChunkSize(len(books))
 	chunks := chunkBooks(books, chunkSize)
 	results := make(chan []*models.Book)
@@ -132,11 +175,17 @@ func (h *SearchHandler) concurrentSearch(books []*models.Book, query string) []*
 			defer wg.Done()
 			var chunkMatches []*models.Book
 			for _, book := range c {
+				if ctx.Err() != nil {
+					return
+				}
 				if containsSearchTerm(book, lowerQuery) {
 					chunkMatches = append(chunkMatches, book)
 				}
 			}
-			results <- chunkMatches
+			select {
+			case results <- chunkMatches:
+			case <-ctx.Done():
+			}
 		}(chunk)
 	}
 
@@ -146,11 +195,17 @@ func (h *SearchHandler) concurrentSearch(books []*models.Book, query string) []*
 	}()
 
 	var matchedBooks []*models.Book
-	for matches := range results {
-		matchedBooks = append(matchedBooks, matches...)
+	for {
+		select {
+		case matches, ok := <-results:
+			if !ok {
+				return matchedBooks, nil
+			}
+			matchedBooks = append(matchedBooks, matches...)
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
-
-	return matchedBooks
 }
 
 func containsSearchTerm(book *models.Book, query string) bool {
@@ -224,15 +279,6 @@ func validateSearchQuery(query string) error {
 	return nil
 }
 
-func sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Failed to encode JSON response: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-	}
-}
-
 func sendJSONError(w http.ResponseWriter, statusCode int, message string) {
 	response := struct {
 		Error string `json:"error"`
@@ -2,7 +2,7 @@ package handlers
 
 import (
 	"book-api/models"
-	"book-api/repository"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -14,49 +14,6 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-type mockSearchRepositoryForTesting struct {
-	books []*models.Book
-}
-
-func (m *mockSearchRepositoryForTesting) GetAllBooks() ([]*models.Book, error) {
-	return m.books, nil
-}
-
-func (m *mockSearchRepositoryForTesting) GetBookByID(id string) (*models.Book, error) {
-	for _, book := range m.books {
-		if book.BookID == id {
-			return book, nil
-		}
-	}
-	return nil, repository.ErrBookNotFound
-}
-
-func (m *mockSearchRepositoryForTesting) CreateBook(book *models.Book) error {
-	m.books = append(m.books, book)
-	return nil
-}
-
-func (m *mockSearchRepositoryForTesting) UpdateBook(id string, book *models.Book) (*models.Book, error) {
-	for i, b := range m.books {
-		if b.BookID == id {
-			book.BookID = id
-			m.books[i] = book
-			return book, nil
-		}
-	}
-	return nil, repository.ErrBookNotFound
-}
-
-func (m *mockSearchRepositoryForTesting) DeleteBook(id string) error {
-	for i, book := range m.books {
-		if book.BookID == id {
-			m.books = append(m.books[:i], m.books[i+1:]...)
-			return nil
-		}
-	}
-	return repository.ErrBookNotFound
-}
-
 func TestExecuteBookSearchEndpoint(t *testing.T) {
 	testCases := []struct {
 		name               string
@@ -175,7 +132,7 @@ func TestExecuteBookSearchEndpoint(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			repo := &mockSearchRepositoryForTesting{books: tc.mockBooks}
+			repo := newTestRepository(t, tc.mockBooks...)
 			handler := NewSearchHandler(repo)
 
 			req, err := http.NewRequest("GET", "/books/search?q="+tc.query, nil)
@@ -254,12 +211,13 @@ func TestConcurrentSearchImplementation(t *testing.T) {
 				})
 			}
 
-			repo := &mockSearchRepositoryForTesting{books: books}
+			repo := newTestRepository(t, books...)
 			handler := NewSearchHandler(repo)
 
 			startTime := time.Now()
-			results := handler.searchBooks(books, scenario.searchTerm)
+			results, err := handler.searchBooks(context.Background(), books, scenario.searchTerm)
 			duration := time.Since(startTime)
+			require.NoError(t, err)
 
 			assert.Len(t, results, scenario.expectedMatchCount)
 			t.Logf("%s: Searched %d books in %v, found %d matches",
@@ -268,6 +226,32 @@ func TestConcurrentSearchImplementation(t *testing.T) {
 	}
 }
 
+func TestConcurrentSearchStopsOnCancellation(t *testing.T) {
+	books := generateTestBooks(500)
+	handler := NewSearchHandler(newTestRepository(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, err := handler.searchBooks(ctx, books, "special")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, results)
+}
+
+func TestExecuteBookSearchTimesOut(t *testing.T) {
+	handler := NewSearchHandler(newTestRepository(t, generateTestBooks(100)...))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+
+	req := httptest.NewRequest("GET", "/books/search?q=book", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	handler.ExecuteBookSearch(rr, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rr.Code)
+}
+
 func TestSearchTermMatchingLogic(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"book-api/repository"
+	"context"
+)
+
+// Apply writes the creates and updates of a plan to repo as one non-atomic
+// batch. A row whose write fails, for instance because its book changed
+// since the plan was made, is turned into a rejection; created rows get the
+// ID of their new book.
+func Apply(ctx context.Context, repo repository.BookRepository, results []Result) error {
+	var ops []repository.BatchOp
+	var indexes []int
+	for i, res := range results {
+		switch res.Action {
+		case Create:
+			ops = append(ops, repository.BatchOp{Kind: repository.BatchCreate, Book: res.Book})
+		case Update:
+			ops = append(ops, repository.BatchOp{Kind: repository.BatchUpdate, ID: res.BookID, IfVersion: res.Version, Book: res.Book})
+		default:
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	batchResults, err := repo.ApplyBatch(ctx, ops, false)
+	if err != nil {
+		return err
+	}
+	for j, result := range batchResults {
+		res := &results[indexes[j]]
+		if result.Err != nil {
+			res.Action = Reject
+			res.Errors = []string{result.Err.Error()}
+			continue
+		}
+		res.BookID = result.Book.BookID
+	}
+	return nil
+}
+
+// Summary counts the results of each action.
+type Summary struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	Rejected  int `json:"rejected"`
+}
+
+func Summarize(results []Result) Summary {
+	var s Summary
+	for _, res := range results {
+		switch res.Action {
+		case Create:
+			s.Created++
+		case Update:
+			s.Updated++
+		case Unchanged:
+			s.Unchanged++
+		case Reject:
+			s.Rejected++
+		}
+	}
+	return s
+}
@@ -0,0 +1,263 @@
+// Package importer reads book catalogs exported by other systems and plans
+// how they merge into the existing catalog.
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Row is one record of an import: the text of each book field it sets, by
+// JSON field name, and the line it starts on. Defaults apply only when the
+// row creates a book. Record is the source's own reference for the record,
+// and Errors explain why it could not be mapped to a book.
+type Row struct {
+	Line     int
+	Record   string
+	Fields   map[string]string
+	Defaults map[string]string
+	Errors   []string
+}
+
+// Fields are the book fields an import can set.
+var Fields = []string{"bookId", "authorId", "publisherId", "title", "publicationDate", "isbn", "pages", "genre", "description", "price", "quantity"}
+
+func isField(name string) bool {
+	for _, field := range Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile maps the columns of a CSV export to book fields.
+type Profile struct {
+	// Columns lists, for each book field, the headers of the columns that may
+	// hold it. The first of them that is present and non-empty in a row wins.
+	Columns map[string][]string `json:"columns"`
+	// Defaults fill fields that no column sets in a row creating a book.
+	Defaults map[string]string `json:"defaults,omitempty"`
+
+	// clean rewrites a field's cell text into the form the field expects.
+	clean map[string]func(string) string
+	// needs are fields a book cannot be created without that the export has
+	// no column for, so they must have defaults.
+	needs []string
+}
+
+// Profiles are the built-in profiles: "default" reads the CSV the API itself
+// exports, the others read the exports of Goodreads and LibraryThing.
+var Profiles = map[string]Profile{
+	"default": defaultProfile(),
+	"goodreads": {
+		Columns: map[string][]string{
+			"title":           {"Title"},
+			"authorId":        {"Author"},
+			"publisherId":     {"Publisher"},
+			"isbn":            {"ISBN13", "ISBN"},
+			"pages":           {"Number of Pages"},
+			"publicationDate": {"Year Published", "Original Publication Year"},
+			"quantity":        {"Owned Copies"},
+		},
+		needs: []string{"price"},
+	},
+	"librarything": {
+		Columns: map[string][]string{
+			"title":           {"Title"},
+			"authorId":        {"Primary Author"},
+			"publisherId":     {"Publication"},
+			"isbn":            {"ISBN", "ISBNs"},
+			"pages":           {"Page Count"},
+			"publicationDate": {"Date"},
+			"price":           {"Purchase Price", "List Price", "Value"},
+			"quantity":        {"Copies"},
+		},
+		clean: map[string]func(string) string{
+			// "Scholastic Press (2008), Edition: 1st, Hardcover"
+			"publisherId": func(s string) string {
+				if i := strings.IndexAny(s, "(,"); i >= 0 {
+					s = s[:i]
+				}
+				return s
+			},
+			// "[0439023483]", or several in "ISBNs": "0439023483, 9780439023481"
+			"isbn": func(s string) string {
+				s, _, _ = strings.Cut(strings.Trim(s, "[]"), ",")
+				return s
+			},
+		},
+	},
+}
+
+func defaultProfile() Profile {
+	p := Profile{Columns: map[string][]string{}}
+	for _, field := range Fields {
+		p.Columns[field] = []string{field}
+	}
+	return p
+}
+
+// Validate reports columns or defaults for fields an import cannot set, and
+// fields the profile needs a default for.
+func (p Profile) Validate() error {
+	for field := range p.Columns {
+		if !isField(field) {
+			return fmt.Errorf("unknown field %q; fields are %s", field, strings.Join(Fields, ", "))
+		}
+	}
+	for field := range p.Defaults {
+		if !isField(field) {
+			return fmt.Errorf("unknown field %q; fields are %s", field, strings.Join(Fields, ", "))
+		}
+	}
+	for _, field := range p.needs {
+		if len(p.Columns[field]) == 0 && p.Defaults[field] == "" {
+			return fmt.Errorf("the export has no %s column; set default.%s", field, field)
+		}
+	}
+	return nil
+}
+
+// With returns a copy of p in which columns replaces the columns of the
+// fields it names and defaults is added to the defaults.
+func (p Profile) With(columns map[string]string, defaults map[string]string) Profile {
+	out := Profile{Columns: map[string][]string{}, Defaults: map[string]string{}, clean: p.clean, needs: p.needs}
+	for field, headers := range p.Columns {
+		out.Columns[field] = headers
+	}
+	for field, header := range columns {
+		out.Columns[field] = []string{header}
+	}
+	for field, value := range p.Defaults {
+		out.Defaults[field] = value
+	}
+	for field, value := range defaults {
+		out.Defaults[field] = value
+	}
+	return out
+}
+
+// LoadProfiles reads custom profiles from a JSON file holding an object of
+// profiles by name.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var profiles map[string]Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, p := range profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %w", path, name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// ErrNoColumns is returned for a CSV header with no column the profile knows.
+var ErrNoColumns = errors.New("no column of the header is mapped to a book field")
+
+// ReadCSV reads a CSV export with a header row into rows, using p to find
+// each field's column. Rows are numbered by the line they start on, counting
+// the header as line 1.
+func ReadCSV(r io.Reader, p Profile) ([]Row, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			// Spreadsheet exports often start with a byte order mark.
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := index[name]; !ok {
+			index[name] = i
+		}
+	}
+
+	columns := map[string][]int{}
+	for field, headers := range p.Columns {
+		for _, h := range headers {
+			if i, ok := index[strings.ToLower(strings.TrimSpace(h))]; ok {
+				columns[field] = append(columns[field], i)
+			}
+		}
+	}
+	if len(columns) == 0 {
+		return nil, ErrNoColumns
+	}
+
+	var rows []Row
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if isBlank(record) {
+			continue
+		}
+		rows = append(rows, Row{Line: line, Fields: p.fields(record, columns), Defaults: p.Defaults})
+	}
+	return rows, nil
+}
+
+func isBlank(record []string) bool {
+	for _, cell := range record {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// fields picks each field's text from record.
+func (p Profile) fields(record []string, columns map[string][]int) map[string]string {
+	fields := map[string]string{}
+	for field, indexes := range columns {
+		for _, i := range indexes {
+			if i >= len(record) {
+				continue
+			}
+			value := record[i]
+			if clean := p.clean[field]; clean != nil {
+				value = clean(value)
+			}
+			if value = strings.TrimSpace(value); value != "" {
+				fields[field] = value
+				break
+			}
+		}
+	}
+	return fields
+}
+
+// ProfileNames lists the names of profiles in order.
+func ProfileNames(profiles map[string]Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
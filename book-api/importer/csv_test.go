@@ -0,0 +1,110 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadCSV(t *testing.T) {
+	t.Run("default profile", func(t *testing.T) {
+		rows, err := ReadCSV(strings.NewReader("\ufeffTitle,isbn,unknown,price\n"+
+			"Dune,111,x,9.5\n"+
+			",,,\n"+
+			"\"Emma,\nVolume 2\",222,,\n"+
+			"Short\n"), Profiles["default"])
+		require.NoError(t, err)
+		require.Len(t, rows, 3)
+
+		assert.Equal(t, Row{Line: 2, Fields: map[string]string{"title": "Dune", "isbn": "111", "price": "9.5"}}, rows[0])
+		assert.Equal(t, 4, rows[1].Line)
+		assert.Equal(t, map[string]string{"title": "Emma,\nVolume 2", "isbn": "222"}, rows[1].Fields)
+		assert.Equal(t, 6, rows[2].Line)
+		assert.Equal(t, map[string]string{"title": "Short"}, rows[2].Fields)
+	})
+
+	t.Run("goodreads", func(t *testing.T) {
+		export := `Book Id,Title,Author,Author l-f,Additional Authors,ISBN,ISBN13,My Rating,Average Rating,Publisher,Binding,Number of Pages,Year Published,Original Publication Year,Date Read,Date Added,Owned Copies
+2767052,"The Hunger Games (The Hunger Games, #1)",Suzanne Collins,"Collins, Suzanne",,"=""0439023483""","=""9780439023481""",5,4.33,Scholastic Press,Hardcover,374,2008,2008,,2015/01/03,1
+5907,The Hobbit,J.R.R. Tolkien,"Tolkien, J.R.R.",,"=""""","=""""",4,4.27,Houghton Mifflin,Paperback,,,1937,,2015/01/03,0
+`
+		rows, err := ReadCSV(strings.NewReader(export), Profiles["goodreads"])
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, map[string]string{
+			"title":           "The Hunger Games (The Hunger Games, #1)",
+			"authorId":        "Suzanne Collins",
+			"publisherId":     "Scholastic Press",
+			"isbn":            `="9780439023481"`,
+			"pages":           "374",
+			"publicationDate": "2008",
+			"quantity":        "1",
+		}, rows[0].Fields)
+		assert.Equal(t, "1937", rows[1].Fields["publicationDate"])
+		assert.Equal(t, "", CleanISBN(rows[1].Fields["isbn"]))
+	})
+
+	t.Run("librarything", func(t *testing.T) {
+		export := `"Book Id","Title","Primary Author","Publication","Date","Page Count","ISBN","ISBNs","Purchase Price","Copies"
+"1","Dune","Herbert, Frank","Ace (1990), Edition: Reissue, Paperback","1990","535","[0441172717]","0441172717, 9780441172719","$8.99","2"
+"2","Emma","Austen, Jane","Penguin","2003","","","9780141439587","",""
+`
+		rows, err := ReadCSV(strings.NewReader(export), Profiles["librarything"])
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, map[string]string{
+			"title":           "Dune",
+			"authorId":        "Herbert, Frank",
+			"publisherId":     "Ace",
+			"isbn":            "0441172717",
+			"pages":           "535",
+			"publicationDate": "1990",
+			"price":           "$8.99",
+			"quantity":        "2",
+		}, rows[0].Fields)
+		assert.Equal(t, "9780141439587", rows[1].Fields["isbn"])
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		p := Profiles["goodreads"].With(map[string]string{"genre": "Exclusive Shelf"}, map[string]string{"price": "10"})
+		require.NoError(t, p.Validate())
+		rows, err := ReadCSV(strings.NewReader("Title,Exclusive Shelf\nDune,to-read\n"), p)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"title": "Dune", "genre": "to-read"}, rows[0].Fields)
+		assert.Equal(t, map[string]string{"price": "10"}, rows[0].Defaults)
+
+		assert.EqualError(t, Profiles["goodreads"].Validate(), "the export has no price column; set default.price")
+		assert.NoError(t, Profiles["goodreads"].With(map[string]string{"price": "List Price"}, nil).Validate())
+
+		assert.Error(t, Profiles["default"].With(map[string]string{"colour": "Colour"}, nil).Validate())
+		assert.Error(t, Profiles["default"].With(nil, map[string]string{"version": "2"}).Validate())
+	})
+
+	t.Run("unusable files", func(t *testing.T) {
+		_, err := ReadCSV(strings.NewReader(""), Profiles["default"])
+		assert.Error(t, err)
+		_, err = ReadCSV(strings.NewReader("Colour,Size\nred,1\n"), Profiles["default"])
+		assert.ErrorIs(t, err, ErrNoColumns)
+		_, err = ReadCSV(strings.NewReader("title\n\"unterminated\n"), Profiles["default"])
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadProfiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"shop":{"columns":{"title":["Name"],"isbn":["EAN","ISBN"]},"defaults":{"quantity":"1"}}}`), 0o644))
+
+	profiles, err := LoadProfiles(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"EAN", "ISBN"}, profiles["shop"].Columns["isbn"])
+	assert.Equal(t, "1", profiles["shop"].Defaults["quantity"])
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"shop":{"columns":{"colour":["Colour"]}}}`), 0o644))
+	_, err = LoadProfiles(path)
+	assert.ErrorContains(t, err, `profile "shop"`)
+}
@@ -0,0 +1,407 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// onixProduct is the part of an ONIX 3.0 Product record, in reference tags,
+// that maps onto a book.
+type onixProduct struct {
+	RecordReference   string
+	NotificationType  string
+	ProductIdentifier []struct {
+		ProductIDType string
+		IDValue       string
+	}
+	DescriptiveDetail struct {
+		TitleDetail []struct {
+			TitleType    string
+			TitleElement []struct {
+				TitleElementLevel  string
+				TitleText          string
+				TitlePrefix        string
+				TitleWithoutPrefix string
+				Subtitle           string
+			}
+		}
+		Contributor []onixContributor
+		Extent      []struct {
+			ExtentType  string
+			ExtentValue string
+			ExtentUnit  string
+		}
+		Subject []struct {
+			MainSubject        *struct{}
+			SubjectCode        string
+			SubjectHeadingText string
+		}
+	}
+	CollateralDetail struct {
+		TextContent []struct {
+			TextType string
+			Text     []struct {
+				Body string `xml:",innerxml"`
+			}
+		}
+	}
+	PublishingDetail struct {
+		Imprint []struct {
+			ImprintName string
+		}
+		Publisher []struct {
+			PublishingRole string
+			PublisherName  string
+		}
+		PublishingDate []struct {
+			PublishingDateRole string
+			Date               struct {
+				Format string `xml:"dateformat,attr"`
+				Value  string `xml:",chardata"`
+			}
+		}
+	}
+	ProductSupply []struct {
+		SupplyDetail []struct {
+			Stock []struct {
+				OnHand string
+			}
+			Price []struct {
+				PriceType    string
+				PriceAmount  string
+				CurrencyCode string
+			}
+		}
+	}
+}
+
+type onixContributor struct {
+	SequenceNumber  string
+	ContributorRole []string
+	PersonName      string
+	NamesBeforeKey  string
+	KeyNames        string
+	CorporateName   string
+}
+
+// ReadONIX reads the Product records of an ONIX for Books 3.0 message in
+// reference tags. Each becomes a row numbered by the line its Product element
+// starts on; a record that cannot be mapped to a book carries the reasons in
+// its Errors.
+func ReadONIX(r io.Reader) ([]Row, error) {
+	dec := xml.NewDecoder(r)
+	var rows []Row
+	root := true
+	for {
+		line, _ := dec.InputPos()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if root {
+			if err := checkONIXRoot(start); err != nil {
+				return nil, err
+			}
+			root = false
+			continue
+		}
+		if start.Name.Local != "Product" {
+			continue
+		}
+
+		var product onixProduct
+		if err := dec.DecodeElement(&product, &start); err != nil {
+			return nil, err
+		}
+		row := product.row()
+		row.Line = line
+		rows = append(rows, row)
+	}
+	if root {
+		return nil, errors.New("the message is empty")
+	}
+	return rows, nil
+}
+
+func checkONIXRoot(start xml.StartElement) error {
+	switch start.Name.Local {
+	case "ONIXMessage":
+	case "ONIXmessage":
+		return errors.New("short-tag ONIX is not supported; send reference tags")
+	default:
+		return fmt.Errorf("root element is %s, not ONIXMessage", start.Name.Local)
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "release" {
+			if !strings.HasPrefix(attr.Value, "3.") {
+				return fmt.Errorf("ONIX release %s is not supported; send ONIX 3.0", attr.Value)
+			}
+			return nil
+		}
+	}
+	return errors.New("ONIXMessage has no release; send ONIX 3.0")
+}
+
+// row maps p onto book fields. Only the fields the record carries are set,
+// so an update keeps the rest of the book.
+func (p *onixProduct) row() Row {
+	row := Row{Record: p.RecordReference, Fields: map[string]string{}}
+	set := func(field, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			row.Fields[field] = value
+		}
+	}
+
+	isbn := p.isbn()
+	set("isbn", isbn)
+	set("title", p.title())
+	if p.NotificationType == "05" {
+		row.Errors = append(row.Errors, "notification type 05 deletes a product, which imports do not do")
+		return row
+	}
+	if isbn == "" {
+		row.Errors = append(row.Errors, "no ISBN-13, GTIN-13 or ISBN-10 in ProductIdentifier")
+	}
+	set("authorId", p.contributors())
+	set("publisherId", p.publisher())
+	set("publicationDate", p.publishingDate())
+	set("pages", p.pages())
+	set("genre", p.subject())
+	set("description", p.description())
+	set("price", p.price())
+	set("quantity", p.stock())
+	return row
+}
+
+// isbn prefers ISBN-13 (type 15), then a GTIN-13 (03) in the 978 or 979
+// Bookland ranges, then ISBN-10 (02).
+func (p *onixProduct) isbn() string {
+	for _, idType := range []string{"15", "03", "02"} {
+		for _, id := range p.ProductIdentifier {
+			value := CleanISBN(id.IDValue)
+			if id.ProductIDType != idType {
+				continue
+			}
+			if idType == "03" && !strings.HasPrefix(value, "978") && !strings.HasPrefix(value, "979") {
+				continue
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// title is the distinctive title (type 01) at product level (01), with its
+// subtitle after a colon.
+func (p *onixProduct) title() string {
+	for _, detail := range p.DescriptiveDetail.TitleDetail {
+		if detail.TitleType != "01" {
+			continue
+		}
+		for _, el := range detail.TitleElement {
+			if el.TitleElementLevel != "01" {
+				continue
+			}
+			title := el.TitleText
+			if title == "" {
+				title = strings.TrimSpace(el.TitlePrefix + " " + el.TitleWithoutPrefix)
+			}
+			if el.Subtitle != "" {
+				title += ": " + el.Subtitle
+			}
+			return title
+		}
+	}
+	return ""
+}
+
+// contributors joins the authors (role A01) in sequence order, or every
+// contributor when none is credited as author.
+func (p *onixProduct) contributors() string {
+	contributors := append([]onixContributor(nil), p.DescriptiveDetail.Contributor...)
+	sort.SliceStable(contributors, func(i, j int) bool {
+		a, _ := strconv.Atoi(contributors[i].SequenceNumber)
+		b, _ := strconv.Atoi(contributors[j].SequenceNumber)
+		return a < b
+	})
+
+	var authors, others []string
+	for _, c := range contributors {
+		name := c.PersonName
+		if name == "" {
+			name = strings.TrimSpace(c.NamesBeforeKey + " " + c.KeyNames)
+		}
+		if name == "" {
+			name = c.CorporateName
+		}
+		if name == "" {
+			continue
+		}
+		others = append(others, name)
+		for _, role := range c.ContributorRole {
+			if role == "A01" {
+				authors = append(authors, name)
+				break
+			}
+		}
+	}
+	if len(authors) == 0 {
+		authors = others
+	}
+	return strings.Join(authors, "; ")
+}
+
+// publisher is the publisher (role 01), or else the imprint.
+func (p *onixProduct) publisher() string {
+	for _, pub := range p.PublishingDetail.Publisher {
+		if pub.PublishingRole == "01" && pub.PublisherName != "" {
+			return pub.PublisherName
+		}
+	}
+	for _, imprint := range p.PublishingDetail.Imprint {
+		if imprint.ImprintName != "" {
+			return imprint.ImprintName
+		}
+	}
+	return ""
+}
+
+// publishingDate is the publication date (role 01) as YYYY-MM-DD, or just the
+// year for dates given by year and month or year alone.
+func (p *onixProduct) publishingDate() string {
+	for _, d := range p.PublishingDetail.PublishingDate {
+		if d.PublishingDateRole != "01" {
+			continue
+		}
+		value := strings.TrimSpace(d.Date.Value)
+		switch d.Date.Format {
+		case "", "00", "13", "14":
+			if len(value) >= 8 {
+				return value[:4] + "-" + value[4:6] + "-" + value[6:8]
+			}
+		case "01", "05":
+			if len(value) >= 4 {
+				return value[:4]
+			}
+		}
+		// Left for parseDate to reject.
+		return value
+	}
+	return ""
+}
+
+// pages is the first page count in pages (unit 03) among the main content
+// (extent type 00), content (11) and total numbered (07) page counts.
+func (p *onixProduct) pages() string {
+	for _, extentType := range []string{"00", "11", "07"} {
+		for _, e := range p.DescriptiveDetail.Extent {
+			if e.ExtentType == extentType && e.ExtentUnit == "03" {
+				return e.ExtentValue
+			}
+		}
+	}
+	return ""
+}
+
+// subject is the heading, or else the code, of the main subject, or of the
+// first subject when none is marked main.
+func (p *onixProduct) subject() string {
+	subjects := p.DescriptiveDetail.Subject
+	for _, s := range subjects {
+		if s.MainSubject != nil {
+			return firstNonEmpty(s.SubjectHeadingText, s.SubjectCode)
+		}
+	}
+	if len(subjects) > 0 {
+		return firstNonEmpty(subjects[0].SubjectHeadingText, subjects[0].SubjectCode)
+	}
+	return ""
+}
+
+// description is the description (text type 03), or else the short
+// description (02), as plain text.
+func (p *onixProduct) description() string {
+	for _, textType := range []string{"03", "02"} {
+		for _, content := range p.CollateralDetail.TextContent {
+			if content.TextType == textType && len(content.Text) > 0 {
+				return plainText(content.Text[0].Body)
+			}
+		}
+	}
+	return ""
+}
+
+// price is the first consumer price including tax (price type 02), or else
+// excluding tax (01). The currency is not kept.
+func (p *onixProduct) price() string {
+	for _, priceType := range []string{"02", "01"} {
+		for _, supply := range p.ProductSupply {
+			for _, detail := range supply.SupplyDetail {
+				for _, price := range detail.Price {
+					if price.PriceType == priceType {
+						return price.PriceAmount
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// stock totals the copies on hand across suppliers.
+func (p *onixProduct) stock() string {
+	total, found := 0, false
+	for _, supply := range p.ProductSupply {
+		for _, detail := range supply.SupplyDetail {
+			for _, stock := range detail.Stock {
+				n, err := strconv.Atoi(strings.TrimSpace(stock.OnHand))
+				if err != nil {
+					// Left for parseCount to reject.
+					return stock.OnHand
+				}
+				total, found = total+n, true
+			}
+		}
+	}
+	if !found {
+		return ""
+	}
+	return strconv.Itoa(total)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+var markup = regexp.MustCompile(`<[^>]*>`)
+
+// plainText flattens the content of an ONIX Text element, which may hold
+// XHTML elements, CDATA or escaped HTML, to whitespace-normalised text.
+func plainText(innerXML string) string {
+	s := strings.NewReplacer("<![CDATA[", "", "]]>", "").Replace(innerXML)
+	s = html.UnescapeString(markup.ReplaceAllString(s, " "))
+	if markup.MatchString(s) {
+		s = html.UnescapeString(markup.ReplaceAllString(s, " "))
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
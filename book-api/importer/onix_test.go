@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readONIXFixture(t *testing.T, name string) ([]Row, error) {
+	f, err := os.Open(filepath.Join("testdata", "onix", name))
+	require.NoError(t, err)
+	defer f.Close()
+	return ReadONIX(f)
+}
+
+func TestReadONIX(t *testing.T) {
+	rows, err := readONIXFixture(t, "catalog.xml")
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+
+	assert.Equal(t, Row{
+		Line:   9,
+		Record: "com.example.9780618260300",
+		Fields: map[string]string{
+			"isbn":            "9780618260300",
+			"title":           "The Hobbit: Or There and Back Again",
+			"authorId":        "J. R. R. Tolkien",
+			"publisherId":     "Houghton Mifflin",
+			"publicationDate": "2002-09-15",
+			"pages":           "300",
+			"genre":           "FICTION / Fantasy / General",
+			"description":     "Bilbo Baggins is a hobbit who enjoys a comfortable life & rarely travels.",
+			"price":           "12.99",
+			"quantity":        "150",
+		},
+	}, rows[0])
+
+	assert.Equal(t, 128, rows[1].Line)
+	assert.Empty(t, rows[1].Errors)
+	assert.Equal(t, map[string]string{
+		"isbn":            "9780441172719",
+		"title":           "Dune",
+		"authorId":        "Frank Herbert",
+		"publisherId":     "Ace",
+		"publicationDate": "1990",
+		"pages":           "604",
+		"genre":           "FLS",
+		"description":     "Set on the desert planet Arrakis & beyond.",
+		"price":           "9.99",
+	}, rows[1].Fields)
+
+	assert.Equal(t, map[string]string{
+		"isbn":            "0141439580",
+		"title":           "Emma",
+		"authorId":        "Penguin Editors",
+		"publisherId":     "Penguin Classics",
+		"publicationDate": "2003",
+		"description":     "Emma Woodhouse, handsome, clever & rich.",
+	}, rows[2].Fields)
+
+	assert.Equal(t, "com.example.obsolete", rows[3].Record)
+	assert.Equal(t, []string{"notification type 05 deletes a product, which imports do not do"}, rows[3].Errors)
+	assert.Equal(t, 240, rows[4].Line)
+	assert.Equal(t, []string{"no ISBN-13, GTIN-13 or ISBN-10 in ProductIdentifier"}, rows[4].Errors)
+	assert.Equal(t, "Wall Calendar 2026", rows[4].Fields["title"])
+}
+
+func TestReadONIXRejectsOtherMessages(t *testing.T) {
+	_, err := readONIXFixture(t, "short-tags.xml")
+	assert.ErrorContains(t, err, "short-tag")
+
+	_, err = readONIXFixture(t, "release-2.1.xml")
+	assert.ErrorContains(t, err, "release 2.1")
+
+	for _, doc := range []string{"", "<Books/>", "<ONIXMessage>", `<ONIXMessage release="3.0"><Product><Title>`} {
+		_, err = ReadONIX(strings.NewReader(doc))
+		assert.Error(t, err, doc)
+	}
+}
+
+func TestPlanONIX(t *testing.T) {
+	rows, err := readONIXFixture(t, "catalog.xml")
+	require.NoError(t, err)
+
+	results := Plan(nil, rows)
+	var actions []Action
+	for _, res := range results {
+		actions = append(actions, res.Action)
+	}
+	assert.Equal(t, []Action{Create, Create, Reject, Reject, Reject}, actions)
+
+	assert.Equal(t, "com.example.9780618260300", results[0].Record)
+	assert.Equal(t, 150, results[0].Book.Quantity)
+	assert.Equal(t, 12.99, results[0].Book.Price)
+	assert.Equal(t, "com.example.0141439580", results[2].Record)
+	assert.Equal(t, []string{"pages must be positive", "price must be positive"}, results[2].Errors)
+	assert.Equal(t, "9780000000002", results[3].ISBN)
+}
@@ -0,0 +1,218 @@
+package importer
+
+import (
+	"book-api/models"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Action is what an import does with a row.
+type Action string
+
+const (
+	Create    Action = "create"
+	Update    Action = "update"
+	Unchanged Action = "unchanged"
+	Reject    Action = "reject"
+)
+
+// Result is the planned outcome of one row.
+type Result struct {
+	Line   int      `json:"line"`
+	Record string   `json:"record,omitempty"`
+	Action Action   `json:"action"`
+	BookID string   `json:"bookId,omitempty"`
+	ISBN   string   `json:"isbn,omitempty"`
+	Title  string   `json:"title,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+
+	// Book is the book to create or the updated book, and Version the
+	// version the update was planned against. BookID is left empty for a
+	// create until it has been applied.
+	Book    *models.Book `json:"-"`
+	Version int64        `json:"-"`
+}
+
+// Plan decides what each row does to existing. A row updates the book with
+// its bookId or, failing that, its ISBN, keeping the fields it does not set;
+// otherwise it creates a new book under a new ID. Rows that could not be
+// mapped, fail to parse or validate, reuse an ISBN or update a book an
+// earlier row already updated are rejected.
+func Plan(existing []*models.Book, rows []Row) []Result {
+	byID := make(map[string]*models.Book, len(existing))
+	// Keyed by the cleaned ISBN, as rows are, so a book stored with a
+	// printed ISBN such as 978-0-439-02348-1 is still found.
+	byISBN := make(map[string]*models.Book, len(existing))
+	for _, book := range existing {
+		byID[book.BookID] = book
+		byISBN[CleanISBN(book.ISBN)] = book
+	}
+	idLines := map[string]int{}
+	isbnLines := map[string]int{}
+
+	results := make([]Result, len(rows))
+	for i, row := range rows {
+		res := &results[i]
+		res.Line, res.Record = row.Line, row.Record
+		if len(row.Errors) > 0 {
+			res.Action, res.Errors = Reject, row.Errors
+			res.ISBN, res.Title = CleanISBN(row.Fields["isbn"]), row.Fields["title"]
+			continue
+		}
+
+		target := byID[row.Fields["bookId"]]
+		if target == nil {
+			target = byISBN[CleanISBN(row.Fields["isbn"])]
+		}
+
+		var book *models.Book
+		if target != nil {
+			copied := *target
+			book = &copied
+		} else {
+			book = models.NewBook()
+			res.Errors = setFields(book, withoutSet(row.Defaults, row.Fields))
+		}
+		res.Errors = append(res.Errors, setFields(book, row.Fields)...)
+		res.ISBN, res.Title = book.ISBN, book.Title
+		if target != nil {
+			res.BookID = target.BookID
+		}
+
+		if len(res.Errors) == 0 {
+			if err := book.Validate(); err != nil {
+				res.Errors = strings.Split(err.Error(), ", ")
+			}
+		}
+		isbn := CleanISBN(book.ISBN)
+		owner := byISBN[isbn]
+		switch {
+		case isbn == "":
+		case owner != nil && (target == nil || owner.BookID != target.BookID):
+			res.Errors = append(res.Errors, fmt.Sprintf("isbn %s belongs to book %s", book.ISBN, owner.BookID))
+		case target != nil && idLines[target.BookID] != 0:
+			res.Errors = append(res.Errors, fmt.Sprintf("book %s is already updated on line %d", target.BookID, idLines[target.BookID]))
+		case isbnLines[isbn] != 0:
+			res.Errors = append(res.Errors, fmt.Sprintf("isbn %s is already imported on line %d", book.ISBN, isbnLines[isbn]))
+		}
+
+		switch {
+		case len(res.Errors) > 0:
+			res.Action = Reject
+			continue
+		case target == nil:
+			res.Action = Create
+		case *book == *target:
+			res.Action = Unchanged
+		default:
+			res.Action = Update
+			res.Version = target.Version
+		}
+		res.Book = book
+		isbnLines[isbn] = row.Line
+		idLines[book.BookID] = row.Line
+	}
+	return results
+}
+
+func withoutSet(defaults, fields map[string]string) map[string]string {
+	out := map[string]string{}
+	for field, value := range defaults {
+		if _, ok := fields[field]; !ok {
+			out[field] = value
+		}
+	}
+	return out
+}
+
+// setFields parses the text of each field onto book. bookId only selects
+// the book to update and is never set.
+func setFields(book *models.Book, fields map[string]string) []string {
+	var errs []string
+	for _, field := range Fields {
+		value, ok := fields[field]
+		if !ok {
+			continue
+		}
+
+		var err error
+		switch field {
+		case "authorId":
+			book.AuthorID = value
+		case "publisherId":
+			book.PublisherID = value
+		case "title":
+			book.Title = value
+		case "genre":
+			book.Genre = value
+		case "description":
+			book.Description = value
+		case "isbn":
+			book.ISBN = CleanISBN(value)
+		case "publicationDate":
+			book.PublicationDate, err = parseDate(value)
+		case "pages":
+			book.Pages, err = parseCount(value)
+		case "quantity":
+			book.Quantity, err = parseCount(value)
+		case "price":
+			book.Price, err = parsePrice(value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %q %v", field, value, err))
+		}
+	}
+	return errs
+}
+
+// CleanISBN strips the hyphens and spaces of a printed ISBN and the quoting
+// spreadsheets add to keep leading zeros, as in ="0439023483".
+func CleanISBN(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '=', '"', '-', ' ':
+			return -1
+		case 'x':
+			return 'X'
+		}
+		return r
+	}, s)
+}
+
+// parseDate accepts 2006-01-02, 2006/01/02 and a bare year.
+func parseDate(s string) (string, error) {
+	if len(s) == 4 {
+		if _, err := strconv.Atoi(s); err == nil {
+			return s, nil
+		}
+	}
+	for _, layout := range []string{"2006-01-02", "2006/01/02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("is not a date like 2006-01-02 or a year")
+}
+
+func parseCount(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("is not a whole number")
+	}
+	return n, nil
+}
+
+// parsePrice ignores currency symbols and codes around the amount.
+func parsePrice(s string) (float64, error) {
+	amount := strings.TrimFunc(s, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsSpace(r) || unicode.Is(unicode.Sc, r)
+	})
+	price, err := strconv.ParseFloat(amount, 64)
+	if err != nil {
+		return 0, fmt.Errorf("is not a price")
+	}
+	return price, nil
+}
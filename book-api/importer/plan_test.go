@@ -0,0 +1,101 @@
+package importer
+
+import (
+	"book-api/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	existing := []*models.Book{
+		{BookID: "b1", Title: "Dune", AuthorID: "a", PublisherID: "p", ISBN: "111", Pages: 500, Price: 9, Version: 3},
+		{BookID: "b2", Title: "Emma", AuthorID: "a", PublisherID: "p", ISBN: "222", Pages: 300, Price: 5, Version: 1},
+		{BookID: "b3", Title: "Ulysses", AuthorID: "a", PublisherID: "p", ISBN: "555", Pages: 700, Price: 5, Version: 1},
+	}
+	valid := func(isbn string) map[string]string {
+		return map[string]string{"title": "New", "authorId": "a", "publisherId": "p", "isbn": isbn, "pages": "10", "price": "$4.50"}
+	}
+
+	rows := []Row{
+		{Line: 2, Fields: valid("978-0-00-000000-0")},
+		{Line: 3, Fields: map[string]string{"isbn": "111", "price": "12"}},
+		{Line: 4, Fields: map[string]string{"bookId": "b2", "title": "Emma"}},
+		{Line: 5, Fields: map[string]string{"bookId": "b2", "isbn": "111"}},
+		{Line: 6, Fields: valid("9780000000000")},
+		{Line: 7, Fields: map[string]string{"isbn": "111", "quantity": "2"}},
+		{Line: 8, Fields: map[string]string{"title": "Bad", "pages": "many", "publicationDate": "next year"}},
+		{Line: 9, Fields: map[string]string{"title": "Incomplete", "isbn": "333"}},
+		{Line: 10, Fields: map[string]string{"title": "Priced", "authorId": "a", "publisherId": "p", "isbn": "444", "pages": "1"},
+			Defaults: map[string]string{"price": "7", "quantity": "1"}},
+		{Line: 11, Fields: map[string]string{"isbn": "555", "publicationDate": "2003/04/01"},
+			Defaults: map[string]string{"price": "7"}},
+	}
+	results := Plan(existing, rows)
+	require.Len(t, results, len(rows))
+
+	actions := map[int]Action{}
+	for _, res := range results {
+		actions[res.Line] = res.Action
+	}
+	assert.Equal(t, map[int]Action{
+		2: Create, 3: Update, 4: Unchanged, 5: Reject, 6: Reject,
+		7: Reject, 8: Reject, 9: Reject, 10: Create, 11: Update,
+	}, actions)
+
+	created := results[0]
+	assert.Empty(t, created.BookID)
+	assert.Equal(t, "9780000000000", created.Book.ISBN)
+	assert.Equal(t, 4.5, created.Book.Price)
+
+	updated := results[1]
+	assert.Equal(t, "b1", updated.BookID)
+	assert.Equal(t, int64(3), updated.Version)
+	assert.Equal(t, 12.0, updated.Book.Price)
+	assert.Equal(t, "Dune", updated.Book.Title)
+	assert.Equal(t, 9.0, existing[0].Price, "existing books are not modified")
+
+	assert.Equal(t, []string{"isbn 111 belongs to book b1"}, results[3].Errors)
+	assert.Equal(t, []string{"isbn 9780000000000 is already imported on line 2"}, results[4].Errors)
+	assert.Equal(t, []string{"book b1 is already updated on line 3"}, results[5].Errors)
+	assert.Equal(t, []string{
+		`publicationDate: "next year" is not a date like 2006-01-02 or a year`,
+		`pages: "many" is not a whole number`,
+	}, results[6].Errors)
+	assert.Contains(t, results[7].Errors, "price must be positive")
+
+	assert.Equal(t, 7.0, results[8].Book.Price)
+	assert.Equal(t, 1, results[8].Book.Quantity)
+	assert.Equal(t, 5.0, results[9].Book.Price, "defaults do not apply to updates")
+	assert.Equal(t, "2003-04-01", results[9].Book.PublicationDate)
+}
+
+func TestPlanMatchesPrintedISBN(t *testing.T) {
+	existing := []*models.Book{
+		{BookID: "b1", Title: "Mockingjay", AuthorID: "a", PublisherID: "p", ISBN: "978-0-439-02348-1", Pages: 400, Price: 9, Version: 2},
+		{BookID: "b2", Title: "Emma", AuthorID: "a", PublisherID: "p", ISBN: "222", Pages: 300, Price: 5, Version: 1},
+	}
+	rows := []Row{
+		{Line: 2, Fields: map[string]string{"isbn": "9780439023481", "price": "12"}},
+		{Line: 3, Fields: map[string]string{"bookId": "b2", "isbn": "9780439023481"}},
+		{Line: 4, Fields: map[string]string{"title": "Copy", "authorId": "a", "publisherId": "p", "isbn": "978 0 439 02348 1", "pages": "1", "price": "1"}},
+	}
+	results := Plan(existing, rows)
+	require.Len(t, results, len(rows))
+
+	assert.Equal(t, Update, results[0].Action)
+	assert.Equal(t, "b1", results[0].BookID)
+	assert.Equal(t, int64(2), results[0].Version)
+
+	assert.Equal(t, Reject, results[1].Action)
+	assert.Equal(t, []string{"isbn 9780439023481 belongs to book b1"}, results[1].Errors)
+
+	assert.Equal(t, Reject, results[2].Action)
+	assert.Equal(t, []string{"book b1 is already updated on line 2"}, results[2].Errors)
+}
+
+func TestCleanISBN(t *testing.T) {
+	assert.Equal(t, "9780439023481", CleanISBN(`="978-0-439-02348-1"`))
+	assert.Equal(t, "043902348X", CleanISBN("0 439 02348 x"))
+}
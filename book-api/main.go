@@ -2,51 +2,309 @@ package main
 
 import (
 	"book-api/handlers"
+	"book-api/importer"
 	"book-api/repository"
+	"book-api/storage"
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	// Initialize storage with file-based persistence
-	dataFilePath := getEnv("DATA_FILE_PATH", "data/books.json")
-	store := repository.NewFileStore(dataFilePath)
-	bookRepo := repository.NewBookRepository(store)
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	backend, err := newBackend()
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+
+	bookHandler := handlers.NewBookHandler(backend.repo)
+	bookHandler.RequireIfMatch = getRequireIfMatch()
+	searchHandler := handlers.NewSearchHandler(backend.repo)
+	bookHandler.MaxPageSize = getMaxPageSize()
+	searchHandler.MaxPageSize = bookHandler.MaxPageSize
+	if path := getEnv("IMPORT_PROFILES_FILE", ""); path != "" {
+		if bookHandler.ImportProfiles, err = importer.LoadProfiles(path); err != nil {
+			log.Fatalf("Invalid IMPORT_PROFILES_FILE: %v", err)
+		}
+	}
+	adminHandler := handlers.NewAdminHandler(backend.reloadStatus(), backend.backupManager(), backend.integrityStatus())
 
-	bookHandler := handlers.NewBookHandler(bookRepo)
-	searchHandler := handlers.NewSearchHandler(bookRepo)
+	router := configureRouter(bookHandler, searchHandler, adminHandler)
 
-	router := configureRouter(bookHandler, searchHandler)
+	startServer(router, backend.close)
+}
 
-	startServer(router)
+// backend is the storage stack selected by STORAGE_DRIVER. fileStore is only
+// set for drivers that keep the catalog in a single watched data file.
+type backend struct {
+	repo      repository.BookRepository
+	fileStore *storage.FileStore
+	closers   []func() error
 }
 
-func configureRouter(bookHandler *handlers.BookHandler, searchHandler *handlers.SearchHandler) *mux.Router {
+func (b *backend) reloadStatus() handlers.ReloadStatusProvider {
+	if b.fileStore == nil {
+		return nil
+	}
+	return b.fileStore
+}
+
+func (b *backend) backupManager() handlers.BackupManager {
+	if b.fileStore == nil {
+		return nil
+	}
+	return b.fileStore
+}
+
+func (b *backend) integrityStatus() handlers.IntegrityStatusProvider {
+	if b.fileStore == nil {
+		return nil
+	}
+	return b.fileStore
+}
+
+// close releases resources in reverse order of acquisition. Calling it again
+// does nothing.
+func (b *backend) close() error {
+	var firstErr error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if err := b.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	b.closers = nil
+	return firstErr
+}
+
+func newBackend() (*backend, error) {
+	b := &backend{}
+
+	switch driver := getEnv("STORAGE_DRIVER", "file"); driver {
+	case "file":
+		store, err := newFileStore()
+		if err != nil {
+			return nil, err
+		}
+		b.repo, b.fileStore = repository.NewBookRepository(store), store
+	case "wal":
+		keys, err := newKeyring()
+		if err != nil {
+			return nil, err
+		}
+		if keys != nil {
+			return nil, errors.New("encryption at rest is only supported by the file and memory drivers")
+		}
+		codec, err := storage.CodecByName(getEnv("DATA_FILE_FORMAT", "json"))
+		if err != nil {
+			return nil, err
+		}
+		compactEvery, err := strconv.Atoi(getEnv("WAL_COMPACT_EVERY", "0"))
+		if err != nil || compactEvery < 0 {
+			return nil, errors.New("invalid WAL_COMPACT_EVERY: must be a non-negative integer")
+		}
+		store, err := storage.NewLogStore(getDataFilePath(), codec, compactEvery)
+		if err != nil {
+			return nil, err
+		}
+		b.repo = repository.NewBookRepository(store)
+		b.closers = append(b.closers, store.Close)
+	case "memory":
+		interval, err := time.ParseDuration(getEnv("SNAPSHOT_INTERVAL", "0s"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SNAPSHOT_INTERVAL: %w", err)
+		}
+		store, err := newFileStore()
+		if err != nil {
+			return nil, err
+		}
+		repo, err := repository.NewMemoryBookRepository(store, interval)
+		if err != nil {
+			return nil, err
+		}
+		store.OnReload(repo.Replace)
+		b.repo, b.fileStore = repo, store
+		b.closers = append(b.closers, repo.Close)
+	case "sqlite":
+		db, err := repository.OpenSQLite(getEnv("SQLITE_PATH", "data/books.db"))
+		if err != nil {
+			return nil, err
+		}
+		repo, err := repository.NewSQLBookRepository(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		b.repo = repo
+		b.closers = append(b.closers, db.Close)
+	case "bolt":
+		db, err := repository.OpenBolt(getEnv("BOLT_PATH", "data/books.bolt"))
+		if err != nil {
+			return nil, err
+		}
+		repo, err := repository.NewBoltBookRepository(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		b.repo = repo
+		b.closers = append(b.closers, db.Close)
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+
+	if b.fileStore != nil {
+		interval, err := time.ParseDuration(getEnv("RELOAD_INTERVAL", "5s"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid RELOAD_INTERVAL: %w", err)
+		}
+		if interval > 0 {
+			stop := b.fileStore.Watch(interval)
+			// Registered last so the watcher stops before the repository flushes.
+			b.closers = append(b.closers, func() error { stop(); return nil })
+		}
+	}
+	return b, nil
+}
+
+func newFileStore() (*storage.FileStore, error) {
+	codec, err := storage.CodecByName(getEnv("DATA_FILE_FORMAT", "json"))
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		codec = storage.NewEncryptedCodec(codec, keys)
+	}
+
+	store, err := storage.NewFileStore(getDataFilePath(), codec)
+	if err != nil {
+		return nil, err
+	}
+	handEdits, err := strconv.ParseBool(getEnv("ACCEPT_HAND_EDITS", "false"))
+	if err != nil {
+		return nil, errors.New("invalid ACCEPT_HAND_EDITS: must be true or false")
+	}
+	store.AcceptHandEdits(handEdits)
+	// Before anything reads the file, so a corrupt one can be recovered from
+	// a backup and an old one is backed up before it is migrated.
+	if err := enableBackups(store); err != nil {
+		return nil, err
+	}
+	if _, err := store.MigrateSchema(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// enableBackups configures backups of the data file from BACKUP_* settings.
+// BACKUP_RETAIN=0 turns them off.
+func enableBackups(store *storage.FileStore) error {
+	retain, err := strconv.Atoi(getEnv("BACKUP_RETAIN", "10"))
+	if err != nil {
+		return fmt.Errorf("invalid BACKUP_RETAIN: %w", err)
+	}
+	if retain <= 0 {
+		return nil
+	}
+
+	minInterval, err := time.ParseDuration(getEnv("BACKUP_MIN_INTERVAL", "0s"))
+	if err != nil {
+		return fmt.Errorf("invalid BACKUP_MIN_INTERVAL: %w", err)
+	}
+
+	dataFilePath := getDataFilePath()
+	dir := getEnv("BACKUP_DIR", filepath.Join(filepath.Dir(dataFilePath), "backups"))
+	backups, err := storage.NewBackups(dir, dataFilePath, retain, minInterval)
+	if err != nil {
+		return err
+	}
+
+	store.EnableBackups(backups)
+	return nil
+}
+
+// newKeyring loads the data file encryption keys, current key first, from
+// DATA_ENCRYPTION_KEY_FILE or else DATA_ENCRYPTION_KEY. DATA_ENCRYPTION_OLD_KEYS
+// adds keys that are only used to read files not yet rewritten after a
+// rotation. It returns nil when encryption is disabled.
+func newKeyring() (*storage.Keyring, error) {
+	text := getEnv("DATA_ENCRYPTION_KEY", "")
+	if path := getEnv("DATA_ENCRYPTION_KEY_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading DATA_ENCRYPTION_KEY_FILE: %w", err)
+		}
+		text = string(data)
+	}
+
+	keys, err := storage.ParseKeys(text)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	oldKeys, err := storage.ParseKeys(getEnv("DATA_ENCRYPTION_OLD_KEYS", ""))
+	if err != nil {
+		return nil, err
+	}
+	return storage.NewKeyring(append(keys, oldKeys...)...)
+}
+
+func getDataFilePath() string {
+	return getEnv("DATA_FILE_PATH", "data/books.json")
+}
+
+func configureRouter(bookHandler *handlers.BookHandler, searchHandler *handlers.SearchHandler, adminHandler *handlers.AdminHandler) *mux.Router {
 	r := mux.NewRouter()
 
-	r.Use(jsonContentTypeMiddleware)
+	cachePolicies, err := parseCachePolicies(getEnv("CACHE_CONTROL", defaultCacheControl))
+	if err != nil {
+		log.Fatalf("Invalid CACHE_CONTROL: %v", err)
+	}
+
 	r.Use(requestLoggingMiddleware)
 	r.Use(corsMiddleware)
+	r.Use(timeoutMiddleware(getRequestTimeout()))
+	r.Use(cacheControlMiddleware(cachePolicies))
 
 	r.HandleFunc("/books", bookHandler.GetBooks).Methods("GET")
 	r.HandleFunc("/books", bookHandler.CreateBook).Methods("POST")
+	r.HandleFunc("/books/bulk", bookHandler.BulkBooks).Methods("POST")
+	r.HandleFunc("/books/import", bookHandler.ImportBooks).Methods("POST")
+	r.HandleFunc("/books/export", bookHandler.ExportBooks).Methods("GET")
+	r.HandleFunc("/books/citations", bookHandler.GetCitations).Methods("GET")
+	// Registered before /books/{id}, which would otherwise match "search".
+	r.HandleFunc("/books/search", searchHandler.ExecuteBookSearch).Methods("GET")
+	// r.HandleFunc("/books/search/advanced", searchHandler.AdvancedBookSearch).Methods("GET")
 	r.HandleFunc("/books/{id}", bookHandler.GetBook).Methods("GET")
 	r.HandleFunc("/books/{id}", bookHandler.UpdateBook).Methods("PUT")
+	r.HandleFunc("/books/{id}", bookHandler.PatchBook).Methods("PATCH")
 	r.HandleFunc("/books/{id}", bookHandler.DeleteBook).Methods("DELETE")
+	r.HandleFunc("/books/{id}/citation", bookHandler.GetCitation).Methods("GET")
 
-	r.HandleFunc("/books/search", searchHandler.ExecuteBookSearch).Methods("GET")
-	// r.HandleFunc("/books/search/advanced", searchHandler.AdvancedBookSearch).Methods("GET")
+	r.HandleFunc("/admin/reload-status", adminHandler.GetReloadStatus).Methods("GET")
+	r.HandleFunc("/admin/integrity", adminHandler.GetIntegrityStatus).Methods("GET")
+	r.HandleFunc("/admin/backups", adminHandler.ListBackups).Methods("GET")
+	r.HandleFunc("/admin/backups/{name}/restore", adminHandler.RestoreBackup).Methods("POST")
 
 	return r
 }
 
-func startServer(router *mux.Router) {
+func startServer(router *mux.Router, closeBackend func() error) {
 	port := getServerPort()
 	server := &http.Server{
 		Addr:    ":" + port,
@@ -79,7 +337,12 @@ func startServer(router *mux.Router) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+	}
+
+	// Flush buffered writes only after in-flight requests have finished.
+	if err := closeBackend(); err != nil {
+		log.Fatalf("Failed to flush storage: %v", err)
 	}
 
 	log.Println("Server stopped gracefully.")
@@ -89,6 +352,30 @@ func getServerPort() string {
 	return getEnv("PORT", "8080")
 }
 
+func getRequestTimeout() time.Duration {
+	timeout, err := time.ParseDuration(getEnv("REQUEST_TIMEOUT", "10s"))
+	if err != nil {
+		log.Fatalf("Invalid REQUEST_TIMEOUT: %v", err)
+	}
+	return timeout
+}
+
+func getMaxPageSize() int {
+	size, err := strconv.Atoi(getEnv("MAX_PAGE_SIZE", strconv.Itoa(handlers.DefaultMaxPageSize)))
+	if err != nil || size <= 0 {
+		log.Fatalf("Invalid MAX_PAGE_SIZE: must be a positive integer")
+	}
+	return size
+}
+
+func getRequireIfMatch() bool {
+	require, err := strconv.ParseBool(getEnv("REQUIRE_IF_MATCH", "false"))
+	if err != nil {
+		log.Fatalf("Invalid REQUIRE_IF_MATCH: must be true or false")
+	}
+	return require
+}
+
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
 		return value
@@ -96,13 +383,6 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func jsonContentTypeMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		next.ServeHTTP(w, r)
-	})
-}
-
 func requestLoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Incoming request: %s %s", r.Method, r.URL.Path)
@@ -110,11 +390,98 @@ func requestLoggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// timeoutMiddleware gives every request a context deadline, which handlers
+// pass down to the repository. A zero timeout disables it.
+func timeoutMiddleware(timeout time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// defaultCacheControl lets clients keep book reads but revalidate them on
+// every use, which the ETag turns into a cheap 304.
+const defaultCacheControl = "/books=no-cache; /books/{id}=no-cache"
+
+// parseCachePolicies reads CACHE_CONTROL, a ";" separated list of
+// "<route template>=<Cache-Control value>" entries.
+func parseCachePolicies(spec string) (map[string]string, error) {
+	policies := make(map[string]string)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, policy, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(route) == "" || strings.TrimSpace(policy) == "" {
+			return nil, fmt.Errorf("entry %q is not <route>=<policy>", entry)
+		}
+		policies[strings.TrimSpace(route)] = strings.TrimSpace(policy)
+	}
+	return policies, nil
+}
+
+// cacheControlMiddleware applies the Cache-Control policy configured for the
+// matched route template to successful and 304 GET responses.
+func cacheControlMiddleware(policies map[string]string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			template, _ := route.GetPathTemplate()
+			policy, ok := policies[template]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, policy: policy}, r)
+		})
+	}
+}
+
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code == http.StatusOK || code == http.StatusNotModified {
+		w.Header().Set("Cache-Control", w.policy)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, If-None-Match, If-Modified-Since")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Accept-Patch, Link, X-Total-Count")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
@@ -0,0 +1,143 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+const (
+	leaderLength      = 24
+	entryLength       = 12
+	subfieldDelimiter = 0x1f
+	fieldTerminator   = 0x1e
+	recordTerminator  = 0x1d
+)
+
+// Marshal encodes r in ISO 2709, the MARC 21 exchange format, filling in the
+// record length and base address of its leader.
+func Marshal(r Record) ([]byte, error) {
+	if len(r.Leader) != leaderLength {
+		return nil, fmt.Errorf("leader is %d bytes, not %d", len(r.Leader), leaderLength)
+	}
+
+	var directory, data bytes.Buffer
+	for _, f := range r.Fields {
+		if len(f.Tag) != 3 {
+			return nil, fmt.Errorf("invalid tag %q", f.Tag)
+		}
+		start := data.Len()
+		if f.IsControl() {
+			data.WriteString(f.Value)
+		} else {
+			data.WriteByte(indicator(f.Ind1))
+			data.WriteByte(indicator(f.Ind2))
+			for _, sf := range f.Subfields {
+				data.WriteByte(subfieldDelimiter)
+				data.WriteByte(sf.Code)
+				data.WriteString(sf.Value)
+			}
+		}
+		data.WriteByte(fieldTerminator)
+		if data.Len()-start > 9999 {
+			return nil, fmt.Errorf("field %s is longer than 9999 bytes", f.Tag)
+		}
+		fmt.Fprintf(&directory, "%s%04d%05d", f.Tag, data.Len()-start, start)
+	}
+	directory.WriteByte(fieldTerminator)
+	data.WriteByte(recordTerminator)
+
+	base := leaderLength + directory.Len()
+	length := base + data.Len()
+	if length > 99999 {
+		return nil, errors.New("record is longer than 99999 bytes")
+	}
+	out := make([]byte, 0, length)
+	out = fmt.Appendf(out, "%05d%s%05d%s", length, r.Leader[5:12], base, r.Leader[17:])
+	out = append(out, directory.Bytes()...)
+	return append(out, data.Bytes()...), nil
+}
+
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
+
+// Unmarshal decodes one ISO 2709 record.
+func Unmarshal(data []byte) (Record, error) {
+	if len(data) < leaderLength {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+	r := Record{Leader: string(data[:leaderLength])}
+	base, err := strconv.Atoi(r.Leader[12:17])
+	if err != nil || base <= leaderLength || base > len(data) || data[base-1] != fieldTerminator {
+		return Record{}, fmt.Errorf("invalid base address %q", r.Leader[12:17])
+	}
+
+	directory := data[leaderLength : base-1]
+	if len(directory)%entryLength != 0 {
+		return Record{}, errors.New("directory is not a whole number of entries")
+	}
+	for i := 0; i < len(directory); i += entryLength {
+		entry := string(directory[i : i+entryLength])
+		length, err1 := strconv.Atoi(entry[3:7])
+		start, err2 := strconv.Atoi(entry[7:12])
+		if err1 != nil || err2 != nil || length < 1 || base+start+length > len(data) {
+			return Record{}, fmt.Errorf("invalid directory entry %q", entry)
+		}
+		value := data[base+start : base+start+length-1]
+
+		f := Field{Tag: entry[:3]}
+		if f.IsControl() {
+			f.Value = string(value)
+		} else {
+			if len(value) < 2 {
+				return Record{}, fmt.Errorf("field %s has no indicators", f.Tag)
+			}
+			f.Ind1, f.Ind2 = value[0], value[1]
+			for _, part := range bytes.Split(value[2:], []byte{subfieldDelimiter})[1:] {
+				if len(part) > 0 {
+					f.Subfields = append(f.Subfields, Subfield{Code: part[0], Value: string(part[1:])})
+				}
+			}
+		}
+		r.Fields = append(r.Fields, f)
+	}
+	return r, nil
+}
+
+// Reader reads consecutive ISO 2709 records.
+type Reader struct {
+	r io.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Read returns the next record, or io.EOF after the last one.
+func (rd *Reader) Read() (Record, error) {
+	data := make([]byte, leaderLength)
+	if _, err := io.ReadFull(rd.r, data); err != nil {
+		return Record{}, err
+	}
+	length, err := strconv.Atoi(string(data[:5]))
+	if err != nil || length <= leaderLength {
+		return Record{}, fmt.Errorf("invalid record length %q", data[:5])
+	}
+	data = append(data, make([]byte, length-leaderLength)...)
+	if _, err := io.ReadFull(rd.r, data[leaderLength:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	if data[length-1] != recordTerminator {
+		return Record{}, errors.New("record does not end with a record terminator")
+	}
+	return Unmarshal(data)
+}
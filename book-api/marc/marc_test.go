@@ -0,0 +1,191 @@
+package marc
+
+import (
+	"book-api/models"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBooks = []*models.Book{
+	{
+		BookID:          "b1",
+		Title:           "The Hobbit: Or There and Back Again",
+		AuthorID:        "J. R. R. Tolkien",
+		PublisherID:     "Houghton Mifflin",
+		PublicationDate: "2002-09-15",
+		ISBN:            "9780618260300",
+		Pages:           300,
+		Genre:           "Fantasy",
+		Description:     "Bilbo Baggins <enjoys> a comfortable life & rarely travels — until now.",
+		Price:           12.99,
+		CreatedAt:       time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		UpdatedAt:       time.Date(2024, 5, 2, 17, 4, 5, 0, time.UTC),
+	},
+	{BookID: "b2", Title: "Emma", PublisherID: "Penguin", ISBN: "0141439580"},
+}
+
+// mapped keeps the fields of book that MARC carries.
+func mapped(book *models.Book) *models.Book {
+	return &models.Book{
+		BookID:          book.BookID,
+		Title:           book.Title,
+		PublisherID:     book.PublisherID,
+		PublicationDate: book.PublicationDate,
+		ISBN:            book.ISBN,
+		Pages:           book.Pages,
+		Genre:           book.Genre,
+		Description:     book.Description,
+	}
+}
+
+func TestFromBook(t *testing.T) {
+	r := FromBook(testBooks[0])
+	assert.Equal(t, "00000nam a22000007c 4500", r.Leader)
+
+	var tags []string
+	for _, f := range r.Fields {
+		tags = append(tags, f.Tag)
+	}
+	assert.Equal(t, []string{"001", "005", "008", "020", "245", "264", "300", "520", "655"}, tags)
+
+	assert.Equal(t, "20240502170405.0", r.Control("005"))
+	assert.Len(t, r.Control("008"), 40)
+	assert.Equal(t, "240301s2002    xx ", r.Control("008")[:18])
+	assert.Equal(t, "und", r.Control("008")[35:38])
+	assert.Equal(t, Field{Tag: "245", Ind1: '0', Ind2: '4', Subfields: []Subfield{
+		{'a', "The Hobbit"}, {'b', "Or There and Back Again"},
+	}}, r.Fields[4])
+	assert.Equal(t, "300 pages", r.Get("300", 'a'))
+	assert.Equal(t, byte('4'), r.Fields[8].Ind2)
+
+	emma := FromBook(testBooks[1])
+	assert.Len(t, emma.Fields, 6)
+	assert.Equal(t, "      nuuuu", emma.Control("008")[:11])
+	assert.Equal(t, byte('0'), emma.Fields[4].Ind2)
+
+	messy := FromBook(&models.Book{Title: "A\x1dTale\n of\x1f  Two Cities"})
+	assert.Equal(t, "A Tale of Two Cities", messy.Get("245", 'a'))
+	assert.Equal(t, byte('2'), messy.Fields[3].Ind2)
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	for _, book := range testBooks {
+		data, err := Marshal(FromBook(book))
+		require.NoError(t, err)
+		buf.Write(data)
+	}
+
+	first, err := Marshal(FromBook(testBooks[0]))
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%05d", len(first)), string(first[:5]))
+	assert.Equal(t, byte(recordTerminator), first[len(first)-1])
+	assert.Equal(t, "nam a22", string(first[5:12]))
+
+	rd := NewReader(&buf)
+	for _, book := range testBooks {
+		r, err := rd.Read()
+		require.NoError(t, err)
+		assert.Equal(t, FromBook(book).Fields, r.Fields)
+		assert.Equal(t, mapped(book), ToBook(r))
+	}
+	_, err = rd.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestLongDescription(t *testing.T) {
+	for _, description := range []string{
+		strings.Repeat("word ", 4000) + "end",
+		strings.Repeat("é", 6000),
+	} {
+		book := &models.Book{BookID: "b3", Title: "Long", Description: description}
+		r := FromBook(book)
+		parts := r.All("520", 'a')
+		assert.Greater(t, len(parts), 1)
+
+		data, err := Marshal(r)
+		require.NoError(t, err)
+		got, err := Unmarshal(data)
+		require.NoError(t, err)
+		if strings.Contains(description, " ") {
+			assert.Equal(t, mapped(book), ToBook(got))
+		} else {
+			assert.Equal(t, description, strings.Join(got.All("520", 'a'), ""))
+		}
+	}
+}
+
+func TestISO2709Errors(t *testing.T) {
+	_, err := Marshal(Record{Leader: "short"})
+	assert.Error(t, err)
+	_, err = Marshal(Record{Leader: leader, Fields: []Field{{Tag: "52"}}})
+	assert.Error(t, err)
+	long := Field{Tag: "520", Subfields: []Subfield{{'a', strings.Repeat("x", 10000)}}}
+	_, err = Marshal(Record{Leader: leader, Fields: []Field{long}})
+	assert.ErrorContains(t, err, "field 520")
+	_, err = Marshal(FromBook(&models.Book{Description: strings.Repeat("x", 100000)}))
+	assert.ErrorContains(t, err, "record is longer")
+
+	data, err := Marshal(FromBook(testBooks[1]))
+	require.NoError(t, err)
+	_, err = NewReader(bytes.NewReader(data[:len(data)-5])).Read()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	corrupt := append([]byte(nil), data...)
+	copy(corrupt[12:17], "00099")
+	_, err = Unmarshal(corrupt)
+	assert.ErrorContains(t, err, "base address")
+
+	_, err = NewReader(strings.NewReader("garbage that is not MARC at all")).Read()
+	assert.ErrorContains(t, err, "record length")
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	var records []Record
+	for _, book := range testBooks {
+		records = append(records, FromBook(book))
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteXML(&buf, records))
+
+	doc := buf.String()
+	assert.True(t, strings.HasPrefix(doc, `<?xml version="1.0" encoding="UTF-8"?>`))
+	assert.Contains(t, doc, `<collection xmlns="http://www.loc.gov/MARC21/slim">`)
+	assert.Contains(t, doc, `<datafield tag="245" ind1="0" ind2="4">`)
+	assert.Contains(t, doc, `<subfield code="a">Bilbo Baggins &lt;enjoys&gt; a comfortable life &amp; rarely travels — until now.</subfield>`)
+
+	read, err := ReadXML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, records, read)
+	for i, r := range read {
+		assert.Equal(t, mapped(testBooks[i]), ToBook(r))
+	}
+}
+
+func TestReadXML(t *testing.T) {
+	// A single record with a prefixed namespace and a 260 in place of 264.
+	records, err := ReadXML(strings.NewReader(`<marc:record xmlns:marc="http://www.loc.gov/MARC21/slim">
+  <marc:leader>00000cam a2200000 a 4500</marc:leader>
+  <marc:controlfield tag="001">x1</marc:controlfield>
+  <marc:datafield tag="260" ind1=" " ind2=" ">
+    <marc:subfield code="b">Ace</marc:subfield>
+    <marc:subfield code="c">1990</marc:subfield>
+  </marc:datafield>
+  <marc:datafield tag="300" ind1=" " ind2=" "><marc:subfield code="a">xii, 604 p.</marc:subfield></marc:datafield>
+</marc:record>`))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, &models.Book{BookID: "x1", PublisherID: "Ace", PublicationDate: "1990", Pages: 604}, ToBook(records[0]))
+
+	for _, doc := range []string{"", "<collection/>", `<record><datafield tag="245" ind1="10"/></record>`, "<record>"} {
+		_, err := ReadXML(strings.NewReader(doc))
+		assert.Error(t, err, doc)
+	}
+}
@@ -0,0 +1,117 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the namespace of MARCXML.
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+type xmlCollection struct {
+	XMLName xml.Name    `xml:"http://www.loc.gov/MARC21/slim collection"`
+	Records []xmlRecord `xml:"record"`
+}
+
+type xmlRecord struct {
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteXML writes records as a MARCXML collection.
+func WriteXML(w io.Writer, records []Record) error {
+	collection := xmlCollection{Records: make([]xmlRecord, 0, len(records))}
+	for _, r := range records {
+		x := xmlRecord{Leader: r.Leader}
+		for _, f := range r.Fields {
+			if f.IsControl() {
+				x.ControlFields = append(x.ControlFields, xmlControlField{f.Tag, f.Value})
+				continue
+			}
+			df := xmlDataField{Tag: f.Tag, Ind1: string(indicator(f.Ind1)), Ind2: string(indicator(f.Ind2))}
+			for _, sf := range f.Subfields {
+				df.Subfields = append(df.Subfields, xmlSubfield{string(sf.Code), sf.Value})
+			}
+			x.DataFields = append(x.DataFields, df)
+		}
+		collection.Records = append(collection.Records, x)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(collection); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadXML reads the records of a MARCXML document, a collection or a single
+// record.
+func ReadXML(r io.Reader) ([]Record, error) {
+	dec := xml.NewDecoder(r)
+	var records []Record
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var x xmlRecord
+		if err := dec.DecodeElement(&x, &start); err != nil {
+			return nil, err
+		}
+		record := Record{Leader: x.Leader}
+		for _, cf := range x.ControlFields {
+			record.Fields = append(record.Fields, Field{Tag: cf.Tag, Value: cf.Value})
+		}
+		for _, df := range x.DataFields {
+			if len(df.Ind1) != 1 || len(df.Ind2) != 1 {
+				return nil, fmt.Errorf("field %s has invalid indicators", df.Tag)
+			}
+			f := Field{Tag: df.Tag, Ind1: df.Ind1[0], Ind2: df.Ind2[0]}
+			for _, sf := range df.Subfields {
+				if len(sf.Code) != 1 {
+					return nil, fmt.Errorf("field %s has invalid subfield code %q", df.Tag, sf.Code)
+				}
+				f.Subfields = append(f.Subfields, Subfield{sf.Code[0], sf.Value})
+			}
+			record.Fields = append(record.Fields, f)
+		}
+		records = append(records, record)
+	}
+	if records == nil {
+		return nil, errors.New("no MARCXML records")
+	}
+	return records, nil
+}
@@ -0,0 +1,220 @@
+// Package marc writes books as MARC 21 bibliographic records, in ISO 2709
+// and in MARCXML, and reads such records back.
+package marc
+
+import (
+	"book-api/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Record is a MARC 21 record: the leader and its fields in tag order.
+type Record struct {
+	Leader string
+	Fields []Field
+}
+
+// Field is a control field (tags 001 to 009), which holds only a Value, or
+// a data field with two indicators and its subfields.
+type Field struct {
+	Tag        string
+	Value      string
+	Ind1, Ind2 byte
+	Subfields  []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+func (f Field) IsControl() bool {
+	return f.Tag < "010"
+}
+
+// Get returns the first subfield code among the fields tag, or "".
+func (r Record) Get(tag string, code byte) string {
+	for _, f := range r.Fields {
+		if f.Tag != tag {
+			continue
+		}
+		for _, sf := range f.Subfields {
+			if sf.Code == code {
+				return sf.Value
+			}
+		}
+	}
+	return ""
+}
+
+// All returns every subfield code among the fields tag, in order.
+func (r Record) All(tag string, code byte) []string {
+	var values []string
+	for _, f := range r.Fields {
+		if f.Tag != tag {
+			continue
+		}
+		for _, sf := range f.Subfields {
+			if sf.Code == code {
+				values = append(values, sf.Value)
+			}
+		}
+	}
+	return values
+}
+
+// Control returns the value of control field tag, or "".
+func (r Record) Control(tag string) string {
+	for _, f := range r.Fields {
+		if f.Tag == tag {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// leader is that of a new record (n) for printed language material (a), a
+// monograph (m), in UCS/Unicode (a), minimal level (7) and without ISBD
+// punctuation (c). Its length and base address are filled in by Marshal.
+const leader = "00000nam a22000007c 4500"
+
+// FromBook maps book onto a MARC 21 record: ISBN to 020, title to 245,
+// publisher and date to 264, pages to 300, description to 520 and genre to
+// 655. Empty fields are left out, and a description too long for one field
+// is split across repeated 520 fields.
+func FromBook(book *models.Book) Record {
+	r := Record{Leader: leader}
+	r.Fields = append(r.Fields,
+		Field{Tag: "001", Value: clean(book.BookID)},
+		Field{Tag: "005", Value: book.UpdatedAt.UTC().Format("20060102150405") + ".0"},
+		Field{Tag: "008", Value: fixedData(book)},
+	)
+	data := func(tag string, ind1, ind2 byte, subfields ...Subfield) {
+		var kept []Subfield
+		for _, sf := range subfields {
+			if sf.Value = clean(sf.Value); sf.Value != "" {
+				kept = append(kept, sf)
+			}
+		}
+		if len(kept) > 0 {
+			r.Fields = append(r.Fields, Field{Tag: tag, Ind1: ind1, Ind2: ind2, Subfields: kept})
+		}
+	}
+
+	data("020", ' ', ' ', Subfield{'a', book.ISBN})
+	title, subtitle, _ := strings.Cut(clean(book.Title), ": ")
+	data("245", '0', nonfiling(title), Subfield{'a', title}, Subfield{'b', subtitle})
+	data("264", ' ', '1', Subfield{'b', book.PublisherID}, Subfield{'c', book.PublicationDate})
+	if book.Pages > 0 {
+		data("300", ' ', ' ', Subfield{'a', strconv.Itoa(book.Pages) + " pages"})
+	}
+	for _, part := range splitText(clean(book.Description), maxSubfieldLength) {
+		data("520", ' ', ' ', Subfield{'a', part})
+	}
+	data("655", ' ', '4', Subfield{'a', book.Genre})
+	return r
+}
+
+// fixedData is the 008 field of book: the date it was entered, its year of
+// publication if known and otherwise codes for unknown or unspecified.
+func fixedData(book *models.Book) string {
+	entered := "      "
+	if !book.CreatedAt.IsZero() {
+		entered = book.CreatedAt.UTC().Format("060102")
+	}
+	dates := "nuuuu"
+	if year := year(book.PublicationDate); year != "" {
+		dates = "s" + year
+	}
+	return entered + dates + "    xx " + "    " + "  " + "    " + " 000 u " + "und" + " d"
+}
+
+var yearPrefix = regexp.MustCompile(`^\d{4}`)
+
+func year(date string) string {
+	return yearPrefix.FindString(strings.TrimSpace(date))
+}
+
+// nonfiling is the count of leading characters of an English article, which
+// 245 second indicator tells filing to skip.
+func nonfiling(title string) byte {
+	for _, article := range []string{"The ", "An ", "A "} {
+		if len(title) > len(article) && strings.EqualFold(title[:len(article)], article) {
+			return byte('0' + len(article))
+		}
+	}
+	return '0'
+}
+
+// clean drops control characters, which include the ISO 2709 delimiters and
+// are not allowed in XML, and normalises white space.
+func clean(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// maxSubfieldLength keeps a field of one subfield within the 9999 bytes of
+// an ISO 2709 directory entry: two indicators, the delimiter and code, and
+// the field terminator take the other 5.
+const maxSubfieldLength = 9999 - 5
+
+// splitText splits s into parts of at most max bytes, at the last space
+// before the limit where there is one and otherwise between runes. The
+// spaces split at are dropped, so joining the parts with a space restores s.
+func splitText(s string, max int) []string {
+	var parts []string
+	for len(s) > max {
+		cut := strings.LastIndexByte(s[:max+1], ' ')
+		next := cut + 1
+		if cut <= 0 {
+			cut = max
+			for !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+			next = cut
+		}
+		parts = append(parts, s[:cut])
+		s = s[next:]
+	}
+	return append(parts, s)
+}
+
+var firstNumber = regexp.MustCompile(`\d+`)
+
+// ToBook reads the fields FromBook writes back into a book. It also takes
+// the publisher and date from 260, as older records have them.
+func ToBook(r Record) *models.Book {
+	book := &models.Book{
+		BookID:          r.Control("001"),
+		ISBN:            r.Get("020", 'a'),
+		Title:           r.Get("245", 'a'),
+		PublisherID:     firstNonEmpty(r.Get("264", 'b'), r.Get("260", 'b')),
+		PublicationDate: firstNonEmpty(r.Get("264", 'c'), r.Get("260", 'c')),
+		Description:     strings.Join(r.All("520", 'a'), " "),
+		Genre:           r.Get("655", 'a'),
+	}
+	if subtitle := r.Get("245", 'b'); subtitle != "" {
+		book.Title += ": " + subtitle
+	}
+	if n := firstNumber.FindString(r.Get("300", 'a')); n != "" {
+		book.Pages, _ = strconv.Atoi(n)
+	}
+	return book
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -22,6 +22,9 @@ type Book struct {
 	Quantity        int       `json:"quantity"`
 	CreatedAt       time.Time `json:"createdAt"`
 	UpdatedAt       time.Time `json:"updatedAt"`
+	// Version starts at 1 and is incremented by every update; it backs the
+	// ETag used for optimistic concurrency.
+	Version int64 `json:"version"`
 }
 
 func NewBook() *Book {
@@ -29,6 +32,7 @@ func NewBook() *Book {
 		BookID:    uuid.New().String(),
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
+		Version:   1,
 	}
 }
 
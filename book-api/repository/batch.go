@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"book-api/models"
+	"context"
+	"errors"
+)
+
+// ErrBatchAborted is reported for every operation of an atomic batch that was
+// not applied because another operation failed.
+var ErrBatchAborted = errors.New("not applied: another operation in the batch failed")
+
+// errBatchFailed makes a store or transaction discard an atomic batch.
+var errBatchFailed = errors.New("batch failed")
+
+type BatchOpKind string
+
+const (
+	BatchCreate      BatchOpKind = "create"
+	BatchUpdate      BatchOpKind = "update"
+	BatchDelete      BatchOpKind = "delete"
+	BatchUpdateWhere BatchOpKind = "updateWhere"
+)
+
+// BatchOp is one operation of ApplyBatch. Create uses Book; Update uses ID,
+// Book and IfVersion; Delete uses ID and IfVersion. UpdateWhere calls Change on
+// a copy of every book matching Filter and saves the result against the
+// version it was read at.
+type BatchOp struct {
+	Kind      BatchOpKind
+	ID        string
+	IfVersion int64
+	Book      *models.Book
+	Filter    BookFilter
+	Change    func(book *models.Book) error
+}
+
+// BatchResult is the outcome of the BatchOp at the same index: the created or
+// updated Book, the books changed by an UpdateWhere, or Err.
+type BatchResult struct {
+	Book    *models.Book
+	Updated []*models.Book
+	Err     error
+}
+
+// batchTarget is what a batch runs against: a repository's public methods, or
+// a store update or transaction when the batch is atomic.
+type batchTarget interface {
+	list() ([]*models.Book, error)
+	create(book *models.Book) error
+	update(id string, book *models.Book, ifVersion int64) (*models.Book, error)
+	delete(id string, ifVersion int64) error
+}
+
+// runBatch applies ops in order. Without atomic every operation stands alone
+// and a failed UpdateWhere keeps the books it changed before the failure. With
+// atomic the first failure stops the batch, marks every other result
+// ErrBatchAborted and returns errBatchFailed so the caller discards the target.
+func runBatch(ctx context.Context, t batchTarget, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		results[i] = runBatchOp(t, op)
+		if results[i].Err != nil && atomic {
+			for j := range results {
+				if j != i {
+					results[j] = BatchResult{Err: ErrBatchAborted}
+				}
+			}
+			return results, errBatchFailed
+		}
+	}
+	return results, nil
+}
+
+func runBatchOp(t batchTarget, op BatchOp) BatchResult {
+	switch op.Kind {
+	case BatchCreate:
+		if err := t.create(op.Book); err != nil {
+			return BatchResult{Err: err}
+		}
+		return BatchResult{Book: op.Book}
+
+	case BatchUpdate:
+		book, err := t.update(op.ID, op.Book, op.IfVersion)
+		return BatchResult{Book: book, Err: err}
+
+	case BatchDelete:
+		return BatchResult{Err: t.delete(op.ID, op.IfVersion)}
+
+	case BatchUpdateWhere:
+		books, err := t.list()
+		if err != nil {
+			return BatchResult{Err: err}
+		}
+
+		var result BatchResult
+		for _, book := range books {
+			if !op.Filter.Matches(book) {
+				continue
+			}
+			changed := cloneBook(book)
+			if err := op.Change(changed); err != nil {
+				result.Err = err
+				return result
+			}
+			updated, err := t.update(book.BookID, changed, book.Version)
+			if err != nil {
+				result.Err = err
+				return result
+			}
+			result.Updated = append(result.Updated, updated)
+		}
+		return result
+
+	default:
+		return BatchResult{Err: errors.New("unknown batch operation " + string(op.Kind))}
+	}
+}
+
+// repositoryTarget runs a non-atomic batch through a repository's own methods.
+type repositoryTarget struct {
+	ctx  context.Context
+	repo BookRepository
+}
+
+func (t repositoryTarget) list() ([]*models.Book, error) {
+	return t.repo.GetAllBooks(t.ctx)
+}
+
+func (t repositoryTarget) create(book *models.Book) error {
+	return t.repo.CreateBook(t.ctx, book)
+}
+
+func (t repositoryTarget) update(id string, book *models.Book, ifVersion int64) (*models.Book, error) {
+	return t.repo.UpdateBook(t.ctx, id, book, ifVersion)
+}
+
+func (t repositoryTarget) delete(id string, ifVersion int64) error {
+	return t.repo.DeleteBook(t.ctx, id, ifVersion)
+}
+
+// sliceTarget applies changes to a whole in-memory catalog, as read from a
+// storage.Store. Replaced books are swapped out rather than mutated.
+type sliceTarget struct {
+	books []*models.Book
+}
+
+func (t *sliceTarget) list() ([]*models.Book, error) {
+	return append([]*models.Book(nil), t.books...), nil
+}
+
+func (t *sliceTarget) create(book *models.Book) error {
+	for _, b := range t.books {
+		if b.BookID == book.BookID {
+			return ErrDuplicateID
+		}
+	}
+	for _, b := range t.books {
+		if b.ISBN == book.ISBN {
+			return ErrDuplicateISBN
+		}
+	}
+
+	book.Version = 1
+	t.books = append(t.books, book)
+	return nil
+}
+
+func (t *sliceTarget) update(id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	for i, book := range t.books {
+		if book.BookID != id {
+			continue
+		}
+		if err := checkVersion(book, ifVersion); err != nil {
+			return nil, err
+		}
+		for j, b := range t.books {
+			if i != j && b.ISBN == updatedBook.ISBN {
+				return nil, ErrDuplicateISBN
+			}
+		}
+
+		updatedBook.BookID = id
+		updatedBook.CreatedAt = book.CreatedAt
+		updatedBook.UpdatedAt = models.NewBook().UpdatedAt
+		updatedBook.Version = book.Version + 1
+		t.books[i] = updatedBook
+		return updatedBook, nil
+	}
+
+	return nil, ErrBookNotFound
+}
+
+func (t *sliceTarget) delete(id string, ifVersion int64) error {
+	for i, book := range t.books {
+		if book.BookID == id {
+			if err := checkVersion(book, ifVersion); err != nil {
+				return err
+			}
+			t.books = append(t.books[:i], t.books[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrBookNotFound
+}
@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"book-api/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	booksBucket       = []byte("books")
+	isbnIndexBucket   = []byte("idx_isbn")
+	authorIndexBucket = []byte("idx_author")
+	pubIndexBucket    = []byte("idx_publisher")
+	genreIndexBucket  = []byte("idx_genre")
+	metaBucket        = []byte("meta")
+
+	modifiedKey = []byte("modified")
+)
+
+// BoltBookRepository stores books in an embedded bbolt database keyed by
+// BookID. ISBN is a unique index (isbn -> id); author, publisher and genre are
+// non-unique indexes whose keys are "value\x00id" with empty values. Every
+// write stamps the catalog's modification time in the meta bucket.
+type BoltBookRepository struct {
+	db *bolt.DB
+}
+
+func OpenBolt(path string) (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return bolt.Open(path, 0644, &bolt.Options{Timeout: 5 * time.Second})
+}
+
+func NewBoltBookRepository(db *bolt.DB) (*BoltBookRepository, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{booksBucket, isbnIndexBucket, authorIndexBucket, pubIndexBucket, genreIndexBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(metaBucket).Get(modifiedKey) == nil {
+			// Unknown for a database from before the stamp was kept.
+			return stampBoltModified(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltBookRepository{db: db}, nil
+}
+
+func (r *BoltBookRepository) GetAllBooks(ctx context.Context) ([]*models.Book, error) {
+	var books []*models.Book
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(booksBucket).ForEach(func(_, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			var book models.Book
+			if err := json.Unmarshal(v, &book); err != nil {
+				return err
+			}
+			books = append(books, &book)
+			return nil
+		})
+	})
+	return books, err
+}
+
+func (r *BoltBookRepository) CatalogModified(ctx context.Context) (time.Time, error) {
+	var modified time.Time
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		modified, err = parseTime(string(tx.Bucket(metaBucket).Get(modifiedKey)))
+		return err
+	})
+	return modified, err
+}
+
+func (r *BoltBookRepository) GetBookByID(ctx context.Context, id string) (*models.Book, error) {
+	var book *models.Book
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		book, err = getBoltBook(tx, id)
+		return err
+	})
+	return book, err
+}
+
+func (r *BoltBookRepository) GetBooksByAuthor(ctx context.Context, authorID string) ([]*models.Book, error) {
+	return r.booksByIndex(ctx, authorIndexBucket, authorID)
+}
+
+func (r *BoltBookRepository) GetBooksByPublisher(ctx context.Context, publisherID string) ([]*models.Book, error) {
+	return r.booksByIndex(ctx, pubIndexBucket, publisherID)
+}
+
+func (r *BoltBookRepository) GetBooksByGenre(ctx context.Context, genre string) ([]*models.Book, error) {
+	return r.booksByIndex(ctx, genreIndexBucket, genre)
+}
+
+func (r *BoltBookRepository) CreateBook(ctx context.Context, book *models.Book) error {
+	return r.update(ctx, func(tx *bolt.Tx) error {
+		return boltTarget{tx: tx}.create(book)
+	})
+}
+
+func (r *BoltBookRepository) UpdateBook(ctx context.Context, id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	var book *models.Book
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		book, err = boltTarget{tx: tx}.update(id, updatedBook, ifVersion)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func (r *BoltBookRepository) DeleteBook(ctx context.Context, id string, ifVersion int64) error {
+	return r.update(ctx, func(tx *bolt.Tx) error {
+		return boltTarget{tx: tx}.delete(id, ifVersion)
+	})
+}
+
+// ApplyBatch runs an atomic batch in one read-write transaction.
+func (r *BoltBookRepository) ApplyBatch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	if !atomic {
+		return runBatch(ctx, repositoryTarget{ctx: ctx, repo: r}, ops, false)
+	}
+
+	var results []BatchResult
+	err := r.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		results, err = runBatch(ctx, boltTarget{tx: tx}, ops, true)
+		return err
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, err
+	}
+	return results, nil
+}
+
+type boltTarget struct {
+	tx *bolt.Tx
+}
+
+func (t boltTarget) list() ([]*models.Book, error) {
+	var books []*models.Book
+	err := t.tx.Bucket(booksBucket).ForEach(func(_, v []byte) error {
+		var book models.Book
+		if err := json.Unmarshal(v, &book); err != nil {
+			return err
+		}
+		books = append(books, &book)
+		return nil
+	})
+	return books, err
+}
+
+func (t boltTarget) create(book *models.Book) error {
+	if t.tx.Bucket(booksBucket).Get([]byte(book.BookID)) != nil {
+		return ErrDuplicateID
+	}
+	if t.tx.Bucket(isbnIndexBucket).Get(isbnKey(book.ISBN)) != nil {
+		return ErrDuplicateISBN
+	}
+	book.Version = 1
+	return putBoltBook(t.tx, book)
+}
+
+func (t boltTarget) update(id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	existing, err := getBoltBook(t.tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(existing, ifVersion); err != nil {
+		return nil, err
+	}
+
+	if owner := t.tx.Bucket(isbnIndexBucket).Get(isbnKey(updatedBook.ISBN)); owner != nil && string(owner) != id {
+		return nil, ErrDuplicateISBN
+	}
+
+	updatedBook.BookID = id
+	updatedBook.CreatedAt = existing.CreatedAt
+	updatedBook.UpdatedAt = models.NewBook().UpdatedAt
+	updatedBook.Version = existing.Version + 1
+
+	if err := deleteBoltIndexes(t.tx, existing); err != nil {
+		return nil, err
+	}
+	if err := putBoltBook(t.tx, updatedBook); err != nil {
+		return nil, err
+	}
+	return updatedBook, nil
+}
+
+func (t boltTarget) delete(id string, ifVersion int64) error {
+	existing, err := getBoltBook(t.tx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(existing, ifVersion); err != nil {
+		return err
+	}
+	if err := deleteBoltIndexes(t.tx, existing); err != nil {
+		return err
+	}
+	return t.tx.Bucket(booksBucket).Delete([]byte(id))
+}
+
+func (r *BoltBookRepository) booksByIndex(ctx context.Context, bucket []byte, value string) ([]*models.Book, error) {
+	var books []*models.Book
+	err := r.view(ctx, func(tx *bolt.Tx) error {
+		prefix := indexKey(value, "")
+		c := tx.Bucket(bucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			book, err := getBoltBook(tx, string(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			books = append(books, book)
+		}
+		return nil
+	})
+	return books, err
+}
+
+func (r *BoltBookRepository) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.db.View(fn)
+}
+
+// update rolls the transaction back if ctx is done by the time fn finishes.
+func (r *BoltBookRepository) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return stampBoltModified(tx)
+	})
+}
+
+func stampBoltModified(tx *bolt.Tx) error {
+	return tx.Bucket(metaBucket).Put(modifiedKey, []byte(formatTime(time.Now())))
+}
+
+func getBoltBook(tx *bolt.Tx, id string) (*models.Book, error) {
+	data := tx.Bucket(booksBucket).Get([]byte(id))
+	if data == nil {
+		return nil, ErrBookNotFound
+	}
+
+	var book models.Book
+	if err := json.Unmarshal(data, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func putBoltBook(tx *bolt.Tx, book *models.Book) error {
+	data, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+	if err := tx.Bucket(booksBucket).Put([]byte(book.BookID), data); err != nil {
+		return err
+	}
+
+	if err := tx.Bucket(isbnIndexBucket).Put(isbnKey(book.ISBN), []byte(book.BookID)); err != nil {
+		return err
+	}
+	for bucket, value := range boltIndexValues(book) {
+		if err := tx.Bucket([]byte(bucket)).Put(indexKey(value, book.BookID), []byte{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteBoltIndexes(tx *bolt.Tx, book *models.Book) error {
+	if err := tx.Bucket(isbnIndexBucket).Delete(isbnKey(book.ISBN)); err != nil {
+		return err
+	}
+	for bucket, value := range boltIndexValues(book) {
+		if err := tx.Bucket([]byte(bucket)).Delete(indexKey(value, book.BookID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func boltIndexValues(book *models.Book) map[string]string {
+	return map[string]string{
+		string(authorIndexBucket): book.AuthorID,
+		string(pubIndexBucket):    book.PublisherID,
+		string(genreIndexBucket):  book.Genre,
+	}
+}
+
+// isbnKey is the ISBN index key of isbn. bbolt keys cannot be empty, so an
+// empty ISBN is stored under a NUL byte, which no real ISBN contains.
+func isbnKey(isbn string) []byte {
+	if isbn == "" {
+		return []byte{0}
+	}
+	return []byte(isbn)
+}
+
+func indexKey(value, id string) []byte {
+	return []byte(value + "\x00" + id)
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBoltBookRepository(t *testing.T) *BoltBookRepository {
+	db, err := OpenBolt(filepath.Join(t.TempDir(), "books.bolt"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := NewBoltBookRepository(db)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestBoltSecondaryIndexes(t *testing.T) {
+	repo := newTestBoltBookRepository(t)
+
+	first := newTestBook("111")
+	first.Genre = "Fiction"
+	second := newTestBook("222")
+	second.Genre = "Fiction"
+	second.AuthorID = "author2"
+	require.NoError(t, repo.CreateBook(testCtx, first))
+	require.NoError(t, repo.CreateBook(testCtx, second))
+
+	books, err := repo.GetBooksByGenre(testCtx, "Fiction")
+	require.NoError(t, err)
+	assert.Len(t, books, 2)
+
+	books, err = repo.GetBooksByAuthor(testCtx, "author2")
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, second.BookID, books[0].BookID)
+
+	// Moving a book to another genre must drop the stale index entry.
+	changed := newTestBook("222")
+	changed.Genre = "History"
+	_, err = repo.UpdateBook(testCtx, second.BookID, changed, AnyVersion)
+	require.NoError(t, err)
+
+	books, err = repo.GetBooksByGenre(testCtx, "Fiction")
+	require.NoError(t, err)
+	assert.Len(t, books, 1)
+
+	// The old ISBN is free again once the book no longer holds it.
+	changed = newTestBook("333")
+	_, err = repo.UpdateBook(testCtx, second.BookID, changed, AnyVersion)
+	require.NoError(t, err)
+	assert.NoError(t, repo.CreateBook(testCtx, newTestBook("222")))
+
+	require.NoError(t, repo.DeleteBook(testCtx, first.BookID, AnyVersion))
+	books, err = repo.GetBooksByPublisher(testCtx, "pub1")
+	require.NoError(t, err)
+	assert.Len(t, books, 2)
+}
+
+func TestBoltCreateRejectsExistingID(t *testing.T) {
+	repo := newTestBoltBookRepository(t)
+
+	first := newTestBook("111")
+	first.Genre = "Fiction"
+	require.NoError(t, repo.CreateBook(testCtx, first))
+
+	clash := newTestBook("222")
+	clash.BookID = first.BookID
+	clash.Genre = "History"
+	assert.ErrorIs(t, repo.CreateBook(testCtx, clash), ErrDuplicateID)
+
+	results, err := repo.ApplyBatch(testCtx, []BatchOp{{Kind: BatchCreate, Book: clash}}, true)
+	require.NoError(t, err)
+	assert.ErrorIs(t, results[0].Err, ErrDuplicateID)
+
+	stored, err := repo.GetBookByID(testCtx, first.BookID)
+	require.NoError(t, err)
+	assert.Equal(t, "111", stored.ISBN)
+	books, err := repo.GetBooksByGenre(testCtx, "History")
+	require.NoError(t, err)
+	assert.Empty(t, books)
+	assert.NoError(t, repo.CreateBook(testCtx, newTestBook("222")))
+}
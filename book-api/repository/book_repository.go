@@ -2,35 +2,78 @@ package repository
 
 import (
 	"book-api/models"
+	"book-api/storage"
+	"context"
 	"errors"
+	"time"
 )
 
 var (
-	ErrBookNotFound  = errors.New("book not found")
-	ErrDuplicateISBN = errors.New("book with this ISBN already exists")
+	ErrBookNotFound    = errors.New("book not found")
+	ErrDuplicateISBN   = errors.New("book with this ISBN already exists")
+	ErrDuplicateID     = errors.New("book with this ID already exists")
+	ErrVersionConflict = errors.New("book has been modified since the given version")
 )
 
+// AnyVersion makes UpdateBook and DeleteBook skip the version check.
+const AnyVersion int64 = 0
+
+// BookRepository methods stop and return ctx.Err() once ctx is done; a write
+// aborted that way leaves the catalog unchanged.
+//
+// CreateBook stores the book at version 1. UpdateBook and DeleteBook only apply
+// if the stored book still has version ifVersion, otherwise they return
+// ErrVersionConflict. UpdateBook sets the version to the stored one plus one.
 type BookRepository interface {
-	GetAllBooks() ([]*models.Book, error)
-	GetBookByID(id string) (*models.Book, error)
-	CreateBook(book *models.Book) error
-	UpdateBook(id string, book *models.Book) (*models.Book, error)
-	DeleteBook(id string) error
+	GetAllBooks(ctx context.Context) ([]*models.Book, error)
+	GetBookByID(ctx context.Context, id string) (*models.Book, error)
+	CreateBook(ctx context.Context, book *models.Book) error
+	UpdateBook(ctx context.Context, id string, book *models.Book, ifVersion int64) (*models.Book, error)
+	DeleteBook(ctx context.Context, id string, ifVersion int64) error
+	// ApplyBatch runs ops in order and reports each outcome. With atomic
+	// either every operation is applied in a single write or none is; the
+	// error is only for failures of the batch as a whole.
+	ApplyBatch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error)
+	// CatalogModified reports when any book was last added, changed or
+	// removed. It may be later than the last change but never earlier.
+	CatalogModified(ctx context.Context) (time.Time, error)
 }
 
+func checkVersion(book *models.Book, ifVersion int64) error {
+	if ifVersion != AnyVersion && book.Version != ifVersion {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// FileBookRepository implements BookRepository on top of any whole-catalog
+// storage.Store.
 type FileBookRepository struct {
-	store *FileStore
+	store storage.Store
 }
 
-func NewBookRepository(store *FileStore) *FileBookRepository {
+func NewBookRepository(store storage.Store) *FileBookRepository {
 	return &FileBookRepository{store: store}
 }
 
-func (r *FileBookRepository) GetAllBooks() ([]*models.Book, error) {
+func (r *FileBookRepository) GetAllBooks(ctx context.Context) ([]*models.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return r.store.ReadAll()
 }
 
-func (r *FileBookRepository) GetBookByID(id string) (*models.Book, error) {
+func (r *FileBookRepository) CatalogModified(ctx context.Context) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return r.store.Modified()
+}
+
+func (r *FileBookRepository) GetBookByID(ctx context.Context, id string) (*models.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	books, err := r.store.ReadAll()
 	if err != nil {
 		return nil, err
@@ -45,63 +88,64 @@ func (r *FileBookRepository) GetBookByID(id string) (*models.Book, error) {
 	return nil, ErrBookNotFound
 }
 
-func (r *FileBookRepository) CreateBook(book *models.Book) error {
-	books, err := r.store.ReadAll()
-	if err != nil {
+func (r *FileBookRepository) CreateBook(ctx context.Context, book *models.Book) error {
+	return r.update(ctx, func(t *sliceTarget) error {
+		return t.create(book)
+	})
+}
+
+func (r *FileBookRepository) UpdateBook(ctx context.Context, id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	var book *models.Book
+	err := r.update(ctx, func(t *sliceTarget) error {
+		var err error
+		book, err = t.update(id, updatedBook, ifVersion)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	for _, b := range books {
-		if b.ISBN == book.ISBN {
-			return ErrDuplicateISBN
-		}
-	}
+	return book, nil
+}
 
-	books = append(books, book)
-	return r.store.WriteAll(books)
+func (r *FileBookRepository) DeleteBook(ctx context.Context, id string, ifVersion int64) error {
+	return r.update(ctx, func(t *sliceTarget) error {
+		return t.delete(id, ifVersion)
+	})
 }
 
-func (r *FileBookRepository) UpdateBook(id string, updatedBook *models.Book) (*models.Book, error) {
-	books, err := r.store.ReadAll()
-	if err != nil {
-		return nil, err
+// ApplyBatch writes an atomic batch to the store at once, or not at all.
+func (r *FileBookRepository) ApplyBatch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	if !atomic {
+		return runBatch(ctx, repositoryTarget{ctx: ctx, repo: r}, ops, false)
 	}
 
-	for i, book := range books {
-		if book.BookID == id {
-			for j, b := range books {
-				if i != j && b.ISBN == updatedBook.ISBN {
-					return nil, ErrDuplicateISBN
-				}
-			}
-
-			updatedBook.BookID = id
-			updatedBook.CreatedAt = book.CreatedAt
-			updatedBook.UpdatedAt = models.NewBook().UpdatedAt
-			books[i] = updatedBook
-
-			if err := r.store.WriteAll(books); err != nil {
-				return nil, err
-			}
-			return updatedBook, nil
-		}
+	var results []BatchResult
+	err := r.update(ctx, func(t *sliceTarget) error {
+		var err error
+		results, err = runBatch(ctx, t, ops, true)
+		return err
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return nil, err
 	}
-
-	return nil, ErrBookNotFound
+	return results, nil
 }
 
-func (r *FileBookRepository) DeleteBook(id string) error {
-	books, err := r.store.ReadAll()
-	if err != nil {
+// update wraps store.Update so that a context cancelled while waiting for the
+// store lock, or while fn ran, aborts before anything is written.
+func (r *FileBookRepository) update(ctx context.Context, fn func(t *sliceTarget) error) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
-
-	for i, book := range books {
-		if book.BookID == id {
-			books = append(books[:i], books[i+1:]...)
-			return r.store.WriteAll(books)
+	return r.store.Update(func(books []*models.Book) ([]*models.Book, error) {
+		t := &sliceTarget{books: books}
+		if err := fn(t); err != nil {
+			return nil, err
 		}
-	}
-
-	return ErrBookNotFound
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return t.books, nil
+	})
 }
@@ -0,0 +1,400 @@
+package repository
+
+import (
+	"book-api/models"
+	"book-api/storage"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCtx = context.Background()
+
+func newTestFileRepository(t *testing.T) BookRepository {
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "books.json"), storage.JSONCodec{})
+	require.NoError(t, err)
+	return NewBookRepository(store)
+}
+
+func newTestBook(isbn string) *models.Book {
+	book := models.NewBook()
+	book.Title = "Book " + isbn
+	book.AuthorID = "author1"
+	book.PublisherID = "pub1"
+	book.ISBN = isbn
+	book.Pages = 100
+	book.Price = 9.99
+	book.Quantity = 1
+	return book
+}
+
+// testBookRepository runs the behaviour every BookRepository implementation
+// has to share, against a fresh repository for each subtest.
+func testBookRepository(t *testing.T, newRepo func(t *testing.T) BookRepository) {
+	t.Run("create_and_get", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, book))
+
+		got, err := repo.GetBookByID(testCtx, book.BookID)
+		require.NoError(t, err)
+		assert.Equal(t, book.Title, got.Title)
+		assert.Equal(t, book.ISBN, got.ISBN)
+
+		books, err := repo.GetAllBooks(testCtx)
+		require.NoError(t, err)
+		assert.Len(t, books, 1)
+	})
+
+	t.Run("get_missing", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.GetBookByID(testCtx, "missing")
+		assert.ErrorIs(t, err, ErrBookNotFound)
+	})
+
+	t.Run("duplicate_isbn_rejected", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.CreateBook(testCtx, newTestBook("111")))
+		assert.ErrorIs(t, repo.CreateBook(testCtx, newTestBook("111")), ErrDuplicateISBN)
+	})
+
+	t.Run("duplicate_id_rejected", func(t *testing.T) {
+		repo := newRepo(t)
+		first := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, first))
+
+		clash := newTestBook("222")
+		clash.BookID = first.BookID
+		assert.ErrorIs(t, repo.CreateBook(testCtx, clash), ErrDuplicateID)
+		for _, atomic := range []bool{true, false} {
+			results, err := repo.ApplyBatch(testCtx, []BatchOp{{Kind: BatchCreate, Book: clash}}, atomic)
+			require.NoError(t, err)
+			assert.ErrorIs(t, results[0].Err, ErrDuplicateID)
+		}
+
+		books, err := repo.GetAllBooks(testCtx)
+		require.NoError(t, err)
+		require.Len(t, books, 1)
+		assert.Equal(t, "111", books[0].ISBN)
+	})
+
+	t.Run("empty_isbn", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("")
+		require.NoError(t, repo.CreateBook(testCtx, book))
+
+		got, err := repo.GetBookByID(testCtx, book.BookID)
+		require.NoError(t, err)
+		assert.Empty(t, got.ISBN)
+
+		changed := newTestBook("")
+		changed.Title = "Changed"
+		_, err = repo.UpdateBook(testCtx, book.BookID, changed, AnyVersion)
+		require.NoError(t, err)
+		other := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, other))
+
+		// An empty ISBN is unique like any other.
+		assert.ErrorIs(t, repo.CreateBook(testCtx, newTestBook("")), ErrDuplicateISBN)
+		_, err = repo.UpdateBook(testCtx, other.BookID, newTestBook(""), AnyVersion)
+		assert.ErrorIs(t, err, ErrDuplicateISBN)
+		results, err := repo.ApplyBatch(testCtx, []BatchOp{{Kind: BatchCreate, Book: newTestBook("")}}, false)
+		require.NoError(t, err)
+		assert.ErrorIs(t, results[0].Err, ErrDuplicateISBN)
+
+		require.NoError(t, repo.DeleteBook(testCtx, book.BookID, AnyVersion))
+		books, err := repo.GetAllBooks(testCtx)
+		require.NoError(t, err)
+		require.Len(t, books, 1)
+		assert.Equal(t, "111", books[0].ISBN)
+		assert.NoError(t, repo.CreateBook(testCtx, newTestBook("")))
+	})
+
+	t.Run("update", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, book))
+
+		changed := newTestBook("222")
+		changed.Title = "Changed"
+		updated, err := repo.UpdateBook(testCtx, book.BookID, changed, AnyVersion)
+		require.NoError(t, err)
+		assert.Equal(t, book.BookID, updated.BookID)
+		assert.Equal(t, "Changed", updated.Title)
+		assert.True(t, book.CreatedAt.Equal(updated.CreatedAt))
+
+		got, err := repo.GetBookByID(testCtx, book.BookID)
+		require.NoError(t, err)
+		assert.Equal(t, "Changed", got.Title)
+		assert.Equal(t, "222", got.ISBN)
+	})
+
+	t.Run("update_to_duplicate_isbn", func(t *testing.T) {
+		repo := newRepo(t)
+		first := newTestBook("111")
+		second := newTestBook("222")
+		require.NoError(t, repo.CreateBook(testCtx, first))
+		require.NoError(t, repo.CreateBook(testCtx, second))
+
+		_, err := repo.UpdateBook(testCtx, second.BookID, newTestBook("111"), AnyVersion)
+		assert.ErrorIs(t, err, ErrDuplicateISBN)
+	})
+
+	t.Run("update_missing", func(t *testing.T) {
+		repo := newRepo(t)
+		_, err := repo.UpdateBook(testCtx, "missing", newTestBook("111"), AnyVersion)
+		assert.ErrorIs(t, err, ErrBookNotFound)
+	})
+
+	t.Run("versions", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("111")
+		book.Version = 7
+		require.NoError(t, repo.CreateBook(testCtx, book))
+
+		got, err := repo.GetBookByID(testCtx, book.BookID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), got.Version)
+
+		updated, err := repo.UpdateBook(testCtx, book.BookID, newTestBook("111"), 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), updated.Version)
+
+		_, err = repo.UpdateBook(testCtx, book.BookID, newTestBook("111"), 1)
+		assert.ErrorIs(t, err, ErrVersionConflict)
+		assert.ErrorIs(t, repo.DeleteBook(testCtx, book.BookID, 1), ErrVersionConflict)
+
+		got, err = repo.GetBookByID(testCtx, book.BookID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), got.Version)
+
+		updated, err = repo.UpdateBook(testCtx, book.BookID, newTestBook("111"), AnyVersion)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), updated.Version)
+
+		require.NoError(t, repo.DeleteBook(testCtx, book.BookID, 3))
+		assert.ErrorIs(t, repo.DeleteBook(testCtx, book.BookID, 3), ErrBookNotFound)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		repo := newRepo(t)
+		kept := newTestBook("111")
+		kept.Genre = "Fantasy"
+		doomed := newTestBook("222")
+		require.NoError(t, repo.CreateBook(testCtx, kept))
+		require.NoError(t, repo.CreateBook(testCtx, doomed))
+
+		raisePrice := func(book *models.Book) error {
+			book.Price = 20
+			return nil
+		}
+		ops := []BatchOp{
+			{Kind: BatchCreate, Book: newTestBook("333")},
+			{Kind: BatchDelete, ID: doomed.BookID, IfVersion: 1},
+			{Kind: BatchUpdateWhere, Filter: BookFilter{Genre: "fantasy"}, Change: raisePrice},
+			{Kind: BatchCreate, Book: newTestBook("111")},
+		}
+
+		t.Run("atomic", func(t *testing.T) {
+			results, err := repo.ApplyBatch(testCtx, ops, true)
+			require.NoError(t, err)
+			require.Len(t, results, len(ops))
+			assert.ErrorIs(t, results[0].Err, ErrBatchAborted)
+			assert.ErrorIs(t, results[3].Err, ErrDuplicateISBN)
+
+			books, err := repo.GetAllBooks(testCtx)
+			require.NoError(t, err)
+			assert.Len(t, books, 2)
+			got, err := repo.GetBookByID(testCtx, kept.BookID)
+			require.NoError(t, err)
+			assert.Equal(t, 9.99, got.Price)
+
+			results, err = repo.ApplyBatch(testCtx, ops[:3], true)
+			require.NoError(t, err)
+			for _, result := range results {
+				assert.NoError(t, result.Err)
+			}
+			require.Len(t, results[2].Updated, 1)
+			assert.Equal(t, int64(2), results[2].Updated[0].Version)
+
+			got, err = repo.GetBookByID(testCtx, kept.BookID)
+			require.NoError(t, err)
+			assert.Equal(t, 20.0, got.Price)
+			_, err = repo.GetBookByID(testCtx, doomed.BookID)
+			assert.ErrorIs(t, err, ErrBookNotFound)
+		})
+
+		t.Run("independent", func(t *testing.T) {
+			results, err := repo.ApplyBatch(testCtx, []BatchOp{
+				{Kind: BatchCreate, Book: newTestBook("444")},
+				{Kind: BatchDelete, ID: doomed.BookID},
+				{Kind: BatchUpdate, ID: kept.BookID, Book: newTestBook("111"), IfVersion: 2},
+			}, false)
+			require.NoError(t, err)
+			assert.NoError(t, results[0].Err)
+			assert.ErrorIs(t, results[1].Err, ErrBookNotFound)
+			require.NoError(t, results[2].Err)
+			assert.Equal(t, int64(3), results[2].Book.Version)
+
+			books, err := repo.GetAllBooks(testCtx)
+			require.NoError(t, err)
+			assert.Len(t, books, 3)
+		})
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, book))
+		require.NoError(t, repo.DeleteBook(testCtx, book.BookID, AnyVersion))
+
+		_, err := repo.GetBookByID(testCtx, book.BookID)
+		assert.ErrorIs(t, err, ErrBookNotFound)
+		assert.ErrorIs(t, repo.DeleteBook(testCtx, book.BookID, AnyVersion), ErrBookNotFound)
+	})
+
+	t.Run("catalog_modified", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, book))
+		created, err := repo.CatalogModified(testCtx)
+		require.NoError(t, err)
+		assert.False(t, created.IsZero())
+
+		// A failed write is no change.
+		time.Sleep(10 * time.Millisecond)
+		assert.ErrorIs(t, repo.DeleteBook(testCtx, "missing", AnyVersion), ErrBookNotFound)
+		unchanged, err := repo.CatalogModified(testCtx)
+		require.NoError(t, err)
+		assert.True(t, unchanged.Equal(created))
+
+		require.NoError(t, repo.DeleteBook(testCtx, book.BookID, AnyVersion))
+		deleted, err := repo.CatalogModified(testCtx)
+		require.NoError(t, err)
+		assert.True(t, deleted.After(created), "deletion at %v should move %v", deleted, created)
+	})
+
+	t.Run("cancelled_context", func(t *testing.T) {
+		repo := newRepo(t)
+		book := newTestBook("111")
+		require.NoError(t, repo.CreateBook(testCtx, book))
+
+		ctx, cancel := context.WithCancel(testCtx)
+		cancel()
+
+		_, err := repo.GetAllBooks(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.ErrorIs(t, repo.CreateBook(ctx, newTestBook("222")), context.Canceled)
+		assert.ErrorIs(t, repo.DeleteBook(ctx, book.BookID, AnyVersion), context.Canceled)
+
+		books, err := repo.GetAllBooks(testCtx)
+		require.NoError(t, err)
+		assert.Len(t, books, 1)
+	})
+
+	t.Run("concurrent_creates", func(t *testing.T) {
+		repo := newRepo(t)
+		const workers = 50
+
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.NoError(t, repo.CreateBook(testCtx, newTestBook(fmt.Sprintf("isbn-%d", i))))
+			}(i)
+		}
+		wg.Wait()
+
+		books, err := repo.GetAllBooks(testCtx)
+		require.NoError(t, err)
+		assert.Len(t, books, workers)
+	})
+
+	t.Run("concurrent_duplicate_creates", func(t *testing.T) {
+		repo := newRepo(t)
+		const workers = 20
+
+		var (
+			wg      sync.WaitGroup
+			mu      sync.Mutex
+			created int
+		)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := repo.CreateBook(testCtx, newTestBook("same-isbn")); err == nil {
+					mu.Lock()
+					created++
+					mu.Unlock()
+				} else {
+					assert.ErrorIs(t, err, ErrDuplicateISBN)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, created)
+		books, err := repo.GetAllBooks(testCtx)
+		require.NoError(t, err)
+		assert.Len(t, books, 1)
+	})
+}
+
+func TestFileBookRepository(t *testing.T) {
+	testBookRepository(t, newTestFileRepository)
+}
+
+func TestFileBookRepositoryCodecs(t *testing.T) {
+	for name, codec := range map[string]storage.Codec{
+		"ndjson": storage.NDJSONCodec{},
+		"gob":    storage.GobCodec{},
+	} {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			testBookRepository(t, func(t *testing.T) BookRepository {
+				store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "books."+name), codec)
+				require.NoError(t, err)
+				return NewBookRepository(store)
+			})
+		})
+	}
+}
+
+func TestLogStoreBookRepository(t *testing.T) {
+	testBookRepository(t, func(t *testing.T) BookRepository {
+		store, err := storage.NewLogStore(filepath.Join(t.TempDir(), "books.json"), storage.JSONCodec{}, 10)
+		require.NoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return NewBookRepository(store)
+	})
+}
+
+func newTestSQLRepository(t *testing.T) BookRepository {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "books.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	repo, err := NewSQLBookRepository(db)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestSQLBookRepository(t *testing.T) {
+	testBookRepository(t, newTestSQLRepository)
+}
+
+func newTestBoltRepository(t *testing.T) BookRepository {
+	return newTestBoltBookRepository(t)
+}
+
+func TestBoltBookRepository(t *testing.T) {
+	testBookRepository(t, newTestBoltRepository)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"book-api/models"
+	"strings"
+)
+
+// BookFilter selects books matching every set criterion. Genre, AuthorID and
+// PublisherID are compared ignoring case; ranges are inclusive. Publication
+// dates are compared as ISO 8601 strings, and books without one never match a
+// date range.
+type BookFilter struct {
+	Genre           string   `json:"genre,omitempty"`
+	AuthorID        string   `json:"authorId,omitempty"`
+	PublisherID     string   `json:"publisherId,omitempty"`
+	MinPrice        *float64 `json:"minPrice,omitempty"`
+	MaxPrice        *float64 `json:"maxPrice,omitempty"`
+	MinPages        *int     `json:"minPages,omitempty"`
+	MaxPages        *int     `json:"maxPages,omitempty"`
+	InStock         *bool    `json:"inStock,omitempty"`
+	PublishedAfter  string   `json:"publishedAfter,omitempty"`
+	PublishedBefore string   `json:"publishedBefore,omitempty"`
+}
+
+func (f BookFilter) IsEmpty() bool {
+	return f == BookFilter{}
+}
+
+func (f BookFilter) Matches(book *models.Book) bool {
+	if !matchField(f.Genre, book.Genre) ||
+		!matchField(f.AuthorID, book.AuthorID) ||
+		!matchField(f.PublisherID, book.PublisherID) {
+		return false
+	}
+	if (f.MinPrice != nil && book.Price < *f.MinPrice) || (f.MaxPrice != nil && book.Price > *f.MaxPrice) {
+		return false
+	}
+	if (f.MinPages != nil && book.Pages < *f.MinPages) || (f.MaxPages != nil && book.Pages > *f.MaxPages) {
+		return false
+	}
+	if f.InStock != nil && *f.InStock != (book.Quantity > 0) {
+		return false
+	}
+	if f.PublishedAfter != "" || f.PublishedBefore != "" {
+		date := book.PublicationDate
+		if date == "" ||
+			(f.PublishedAfter != "" && date < f.PublishedAfter) ||
+			(f.PublishedBefore != "" && date > f.PublishedBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchField(want, got string) bool {
+	return want == "" || strings.EqualFold(want, got)
+}
@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"book-api/models"
+	"book-api/storage"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// MemoryBookRepository serves every read from memory, with books indexed by ID
+// and ISBN. When a store is configured the catalog is loaded from it on start
+// and persisted either on every write (snapshotInterval == 0) or by a
+// background snapshot every snapshotInterval. Stored books are never mutated
+// in place, so a snapshot only needs a shallow copy of the slice.
+type MemoryBookRepository struct {
+	mu       sync.RWMutex
+	books    []*models.Book
+	byID     map[string]*models.Book
+	byISBN   map[string]string
+	modified time.Time
+
+	store            storage.Store
+	snapshotInterval time.Duration
+	flushMu          sync.Mutex
+	dirty            bool
+	stop             chan struct{}
+	done             chan struct{}
+}
+
+func NewMemoryBookRepository(store storage.Store, snapshotInterval time.Duration) (*MemoryBookRepository, error) {
+	r := &MemoryBookRepository{
+		byID:             make(map[string]*models.Book),
+		byISBN:           make(map[string]string),
+		store:            store,
+		snapshotInterval: snapshotInterval,
+	}
+
+	if store != nil {
+		books, err := store.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		for _, book := range books {
+			r.insert(book)
+		}
+		if r.modified, err = store.Modified(); err != nil {
+			return nil, err
+		}
+	}
+	if r.modified.IsZero() {
+		r.modified = time.Now()
+	}
+
+	if store != nil && snapshotInterval > 0 {
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.snapshotLoop()
+	}
+	return r, nil
+}
+
+func (r *MemoryBookRepository) GetAllBooks(ctx context.Context) ([]*models.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	books := make([]*models.Book, len(r.books))
+	for i, book := range r.books {
+		books[i] = cloneBook(book)
+	}
+	return books, nil
+}
+
+func (r *MemoryBookRepository) CatalogModified(ctx context.Context) (time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return time.Time{}, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.modified, nil
+}
+
+func (r *MemoryBookRepository) GetBookByID(ctx context.Context, id string) (*models.Book, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	book, ok := r.byID[id]
+	if !ok {
+		return nil, ErrBookNotFound
+	}
+	return cloneBook(book), nil
+}
+
+func (r *MemoryBookRepository) CreateBook(ctx context.Context, book *models.Book) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, taken := r.byID[book.BookID]; taken {
+		return ErrDuplicateID
+	}
+	if _, taken := r.byISBN[book.ISBN]; taken {
+		return ErrDuplicateISBN
+	}
+
+	book.Version = 1
+	stored := cloneBook(book)
+	r.insert(stored)
+	if err := r.persist(); err != nil {
+		r.remove(stored.BookID)
+		return err
+	}
+	return nil
+}
+
+func (r *MemoryBookRepository) UpdateBook(ctx context.Context, id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	existing, ok := r.byID[id]
+	if !ok {
+		return nil, ErrBookNotFound
+	}
+	if err := checkVersion(existing, ifVersion); err != nil {
+		return nil, err
+	}
+	if owner, taken := r.byISBN[updatedBook.ISBN]; taken && owner != id {
+		return nil, ErrDuplicateISBN
+	}
+
+	updatedBook.BookID = id
+	updatedBook.CreatedAt = existing.CreatedAt
+	updatedBook.UpdatedAt = models.NewBook().UpdatedAt
+	updatedBook.Version = existing.Version + 1
+
+	r.replace(existing, cloneBook(updatedBook))
+	if err := r.persist(); err != nil {
+		r.replace(r.byID[id], existing)
+		return nil, err
+	}
+	return updatedBook, nil
+}
+
+func (r *MemoryBookRepository) DeleteBook(ctx context.Context, id string, ifVersion int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	existing, ok := r.byID[id]
+	if !ok {
+		return ErrBookNotFound
+	}
+	if err := checkVersion(existing, ifVersion); err != nil {
+		return err
+	}
+
+	pos := r.remove(id)
+	if err := r.persist(); err != nil {
+		r.insertAt(pos, existing)
+		return err
+	}
+	return nil
+}
+
+// ApplyBatch runs an atomic batch on a copy of the catalog and swaps it in
+// with a single persist.
+func (r *MemoryBookRepository) ApplyBatch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	if !atomic {
+		return runBatch(ctx, repositoryTarget{ctx: ctx, repo: r}, ops, false)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := &sliceTarget{books: append([]*models.Book(nil), r.books...)}
+	results, err := runBatch(ctx, t, ops, true)
+	if errors.Is(err, errBatchFailed) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	books, byID, byISBN := r.books, r.byID, r.byISBN
+	r.books = nil
+	r.byID = make(map[string]*models.Book, len(t.books))
+	r.byISBN = make(map[string]string, len(t.books))
+	for _, book := range t.books {
+		r.insert(cloneBook(book))
+	}
+	if err := r.persist(); err != nil {
+		r.books, r.byID, r.byISBN = books, byID, byISBN
+		return nil, err
+	}
+	return results, nil
+}
+
+// Replace swaps in a whole new catalog atomically, e.g. after the data file
+// was edited externally. The file is treated as the source of truth, so
+// changes not yet snapshotted are discarded.
+func (r *MemoryBookRepository) Replace(books []*models.Book) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.dirty {
+		log.Printf("WARNING: discarding unsaved in-memory changes in favour of reloaded catalog")
+	}
+
+	r.books = nil
+	r.byID = make(map[string]*models.Book, len(books))
+	r.byISBN = make(map[string]string, len(books))
+	for _, book := range books {
+		r.insert(cloneBook(book))
+	}
+	r.dirty = false
+	r.modified = time.Now()
+}
+
+// Flush writes the current catalog to the store if it changed since the last
+// snapshot. It is a no-op in write-through mode.
+func (r *MemoryBookRepository) Flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	r.mu.Lock()
+	if !r.dirty || r.store == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	snapshot := append([]*models.Book(nil), r.books...)
+	r.dirty = false
+	r.mu.Unlock()
+
+	if err := r.store.WriteAll(snapshot); err != nil {
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Close stops the snapshot loop and flushes any pending changes.
+func (r *MemoryBookRepository) Close() error {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop = nil
+	}
+	return r.Flush()
+}
+
+func (r *MemoryBookRepository) snapshotLoop() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.snapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Flush(); err != nil {
+				log.Printf("Snapshot failed, will retry: %v", err)
+			}
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// persist must be called with mu held. Every change goes through it, so it
+// also stamps the catalog as modified; a change rolled back after a failed
+// write keeps the stamp, which only costs a client a full response.
+func (r *MemoryBookRepository) persist() error {
+	r.modified = time.Now()
+	if r.store == nil {
+		return nil
+	}
+	if r.snapshotInterval > 0 {
+		r.dirty = true
+		return nil
+	}
+	return r.store.WriteAll(r.books)
+}
+
+func (r *MemoryBookRepository) insert(book *models.Book) {
+	r.insertAt(len(r.books), book)
+}
+
+func (r *MemoryBookRepository) insertAt(pos int, book *models.Book) {
+	r.books = append(r.books, nil)
+	copy(r.books[pos+1:], r.books[pos:])
+	r.books[pos] = book
+	r.index(book)
+}
+
+func (r *MemoryBookRepository) replace(old, book *models.Book) {
+	for i, b := range r.books {
+		if b == old {
+			r.books[i] = book
+			break
+		}
+	}
+	r.unindex(old)
+	r.index(book)
+}
+
+func (r *MemoryBookRepository) remove(id string) int {
+	book := r.byID[id]
+	for i, b := range r.books {
+		if b == book {
+			r.books = append(r.books[:i], r.books[i+1:]...)
+			r.unindex(book)
+			return i
+		}
+	}
+	return -1
+}
+
+// An empty ISBN is indexed like any other, so at most one book lacks one, as
+// in the other repositories.
+func (r *MemoryBookRepository) index(book *models.Book) {
+	r.byID[book.BookID] = book
+	r.byISBN[book.ISBN] = book.BookID
+}
+
+func (r *MemoryBookRepository) unindex(book *models.Book) {
+	delete(r.byID, book.BookID)
+	if r.byISBN[book.ISBN] == book.BookID {
+		delete(r.byISBN, book.ISBN)
+	}
+}
+
+func cloneBook(book *models.Book) *models.Book {
+	clone := *book
+	return &clone
+}
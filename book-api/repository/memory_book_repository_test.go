@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"book-api/models"
+	"book-api/storage"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryBookRepository(t *testing.T) {
+	t.Run("no_store", func(t *testing.T) {
+		testBookRepository(t, func(t *testing.T) BookRepository {
+			repo, err := NewMemoryBookRepository(nil, 0)
+			require.NoError(t, err)
+			return repo
+		})
+	})
+
+	t.Run("write_through", func(t *testing.T) {
+		testBookRepository(t, func(t *testing.T) BookRepository {
+			store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "books.json"), storage.JSONCodec{})
+			require.NoError(t, err)
+			repo, err := NewMemoryBookRepository(store, 0)
+			require.NoError(t, err)
+			return repo
+		})
+	})
+}
+
+func TestMemoryBookRepositoryWriteThroughPersists(t *testing.T) {
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "books.json"), storage.JSONCodec{})
+	require.NoError(t, err)
+
+	repo, err := NewMemoryBookRepository(store, 0)
+	require.NoError(t, err)
+	book := newTestBook("111")
+	require.NoError(t, repo.CreateBook(testCtx, book))
+
+	reloaded, err := NewMemoryBookRepository(store, 0)
+	require.NoError(t, err)
+	got, err := reloaded.GetBookByID(testCtx, book.BookID)
+	require.NoError(t, err)
+	assert.Equal(t, book.ISBN, got.ISBN)
+	assert.ErrorIs(t, reloaded.CreateBook(testCtx, newTestBook("111")), ErrDuplicateISBN)
+}
+
+func TestMemoryBookRepositorySnapshotInterval(t *testing.T) {
+	store, err := storage.NewFileStore(filepath.Join(t.TempDir(), "books.json"), storage.JSONCodec{})
+	require.NoError(t, err)
+
+	repo, err := NewMemoryBookRepository(store, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateBook(testCtx, newTestBook("111")))
+
+	// Nothing reaches disk until a snapshot is taken.
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Empty(t, books)
+
+	require.NoError(t, repo.Close())
+	books, err = store.ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, books, 1)
+}
+
+func TestMemoryBookRepositoryReturnsCopies(t *testing.T) {
+	repo, err := NewMemoryBookRepository(nil, 0)
+	require.NoError(t, err)
+	book := newTestBook("111")
+	require.NoError(t, repo.CreateBook(testCtx, book))
+
+	got, err := repo.GetBookByID(testCtx, book.BookID)
+	require.NoError(t, err)
+	got.Title = "Mutated by caller"
+
+	again, err := repo.GetBookByID(testCtx, book.BookID)
+	require.NoError(t, err)
+	assert.Equal(t, book.Title, again.Title)
+}
+
+func TestMemoryBookRepositoryReplace(t *testing.T) {
+	repo, err := NewMemoryBookRepository(nil, 0)
+	require.NoError(t, err)
+	old := newTestBook("111")
+	require.NoError(t, repo.CreateBook(testCtx, old))
+
+	replacement := newTestBook("222")
+	repo.Replace([]*models.Book{replacement})
+
+	_, err = repo.GetBookByID(testCtx, old.BookID)
+	assert.ErrorIs(t, err, ErrBookNotFound)
+	got, err := repo.GetBookByID(testCtx, replacement.BookID)
+	require.NoError(t, err)
+	assert.Equal(t, "222", got.ISBN)
+
+	// The old ISBN index entry went away with the old catalog.
+	assert.NoError(t, repo.CreateBook(testCtx, newTestBook("111")))
+	assert.ErrorIs(t, repo.CreateBook(testCtx, newTestBook("222")), ErrDuplicateISBN)
+}
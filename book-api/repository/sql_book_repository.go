@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"book-api/models"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const bookColumns = `book_id, author_id, publisher_id, title, publication_date, isbn,
+	pages, genre, description, price, quantity, created_at, updated_at, version`
+
+type SQLBookRepository struct {
+	db *sql.DB
+}
+
+// NewSQLBookRepository brings the schema up to date and returns a repository
+// backed by db.
+func NewSQLBookRepository(db *sql.DB) (*SQLBookRepository, error) {
+	if err := migrateSQL(db); err != nil {
+		return nil, err
+	}
+	return &SQLBookRepository{db: db}, nil
+}
+
+func (r *SQLBookRepository) GetAllBooks(ctx context.Context) ([]*models.Book, error) {
+	return sqlTarget{ctx: ctx, q: r.db}.list()
+}
+
+func (r *SQLBookRepository) CatalogModified(ctx context.Context) (time.Time, error) {
+	var modified string
+	if err := r.db.QueryRowContext(ctx, `SELECT modified_at FROM catalog WHERE id = 1`).Scan(&modified); err != nil {
+		return time.Time{}, err
+	}
+	return parseTime(modified)
+}
+
+func (r *SQLBookRepository) GetBookByID(ctx context.Context, id string) (*models.Book, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+bookColumns+` FROM books WHERE book_id = ?`, id)
+	book, err := scanBook(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBookNotFound
+	}
+	return book, err
+}
+
+func (r *SQLBookRepository) CreateBook(ctx context.Context, book *models.Book) error {
+	return sqlTarget{ctx: ctx, q: r.db}.create(book)
+}
+
+func (r *SQLBookRepository) UpdateBook(ctx context.Context, id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	book, err := sqlTarget{ctx: ctx, q: tx}.update(id, updatedBook, ifVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
+
+func (r *SQLBookRepository) DeleteBook(ctx context.Context, id string, ifVersion int64) error {
+	return sqlTarget{ctx: ctx, q: r.db}.delete(id, ifVersion)
+}
+
+// ApplyBatch runs an atomic batch in one transaction.
+func (r *SQLBookRepository) ApplyBatch(ctx context.Context, ops []BatchOp, atomic bool) ([]BatchResult, error) {
+	if !atomic {
+		return runBatch(ctx, repositoryTarget{ctx: ctx, repo: r}, ops, false)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results, err := runBatch(ctx, sqlTarget{ctx: ctx, q: tx}, ops, true)
+	if errors.Is(err, errBatchFailed) {
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// sqlQuerier is satisfied by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+type sqlTarget struct {
+	ctx context.Context
+	q   sqlQuerier
+}
+
+func (t sqlTarget) list() ([]*models.Book, error) {
+	rows, err := t.q.QueryContext(t.ctx, `SELECT `+bookColumns+` FROM books ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []*models.Book
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+	return books, rows.Err()
+}
+
+func (t sqlTarget) create(book *models.Book) error {
+	book.Version = 1
+	_, err := t.q.ExecContext(t.ctx, `INSERT INTO books (`+bookColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		book.BookID, book.AuthorID, book.PublisherID, book.Title, book.PublicationDate, book.ISBN,
+		book.Pages, book.Genre, book.Description, book.Price, book.Quantity,
+		formatTime(book.CreatedAt), formatTime(book.UpdatedAt), book.Version)
+	return translateSQLError(err)
+}
+
+// update reads and writes the row separately, so q must be a transaction.
+func (t sqlTarget) update(id string, updatedBook *models.Book, ifVersion int64) (*models.Book, error) {
+	var (
+		createdAt string
+		existing  models.Book
+	)
+	err := t.q.QueryRowContext(t.ctx, `SELECT created_at, version FROM books WHERE book_id = ?`, id).
+		Scan(&createdAt, &existing.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(&existing, ifVersion); err != nil {
+		return nil, err
+	}
+
+	updatedBook.BookID = id
+	if updatedBook.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	updatedBook.UpdatedAt = models.NewBook().UpdatedAt
+	updatedBook.Version = existing.Version + 1
+
+	_, err = t.q.ExecContext(t.ctx, `UPDATE books SET author_id = ?, publisher_id = ?, title = ?, publication_date = ?,
+		isbn = ?, pages = ?, genre = ?, description = ?, price = ?, quantity = ?, updated_at = ?, version = ?
+		WHERE book_id = ?`,
+		updatedBook.AuthorID, updatedBook.PublisherID, updatedBook.Title, updatedBook.PublicationDate,
+		updatedBook.ISBN, updatedBook.Pages, updatedBook.Genre, updatedBook.Description,
+		updatedBook.Price, updatedBook.Quantity, formatTime(updatedBook.UpdatedAt), updatedBook.Version, id)
+	if err != nil {
+		return nil, translateSQLError(err)
+	}
+	return updatedBook, nil
+}
+
+func (t sqlTarget) delete(id string, ifVersion int64) error {
+	res, err := t.q.ExecContext(t.ctx, `DELETE FROM books WHERE book_id = ? AND (? = 0 OR version = ?)`,
+		id, ifVersion, ifVersion)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// Nothing deleted: tell a missing book from a version mismatch.
+	var exists bool
+	err = t.q.QueryRowContext(t.ctx, `SELECT EXISTS (SELECT 1 FROM books WHERE book_id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrBookNotFound
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanBook(row rowScanner) (*models.Book, error) {
+	var (
+		book                 models.Book
+		createdAt, updatedAt string
+	)
+	err := row.Scan(&book.BookID, &book.AuthorID, &book.PublisherID, &book.Title, &book.PublicationDate,
+		&book.ISBN, &book.Pages, &book.Genre, &book.Description, &book.Price, &book.Quantity,
+		&createdAt, &updatedAt, &book.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if book.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if book.UpdatedAt, err = parseTime(updatedAt); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
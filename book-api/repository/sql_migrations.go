@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+type sqlMigration struct {
+	version    int
+	statements []string
+}
+
+// sqlMigrations is applied in order. Never edit a released migration; append
+// a new version instead.
+var sqlMigrations = []sqlMigration{
+	{
+		version: 1,
+		statements: []string{
+			`CREATE TABLE books (
+				id               INTEGER PRIMARY KEY AUTOINCREMENT,
+				book_id          TEXT    NOT NULL UNIQUE,
+				author_id        TEXT    NOT NULL,
+				publisher_id     TEXT    NOT NULL,
+				title            TEXT    NOT NULL,
+				publication_date TEXT    NOT NULL DEFAULT '',
+				isbn             TEXT    NOT NULL,
+				pages            INTEGER NOT NULL,
+				genre            TEXT    NOT NULL DEFAULT '',
+				description      TEXT    NOT NULL DEFAULT '',
+				price            REAL    NOT NULL,
+				quantity         INTEGER NOT NULL,
+				created_at       TEXT    NOT NULL,
+				updated_at       TEXT    NOT NULL
+			)`,
+		},
+	},
+	{
+		version: 2,
+		statements: []string{
+			`CREATE UNIQUE INDEX idx_books_isbn ON books (isbn)`,
+			`CREATE INDEX idx_books_author_id ON books (author_id)`,
+			`CREATE INDEX idx_books_publisher_id ON books (publisher_id)`,
+		},
+	},
+	{
+		version: 3,
+		statements: []string{
+			`ALTER TABLE books ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		// A single row stamped by triggers, so deletions and writes made
+		// outside the service also move it.
+		version: 4,
+		statements: []string{
+			`CREATE TABLE catalog (
+				id          INTEGER PRIMARY KEY CHECK (id = 1),
+				modified_at TEXT    NOT NULL
+			)`,
+			`INSERT INTO catalog (id, modified_at) VALUES (1, strftime('%Y-%m-%dT%H:%M:%fZ', 'now'))`,
+			`CREATE TRIGGER books_inserted AFTER INSERT ON books BEGIN
+				UPDATE catalog SET modified_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+			END`,
+			`CREATE TRIGGER books_updated AFTER UPDATE ON books BEGIN
+				UPDATE catalog SET modified_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+			END`,
+			`CREATE TRIGGER books_deleted AFTER DELETE ON books BEGIN
+				UPDATE catalog SET modified_at = strftime('%Y-%m-%dT%H:%M:%fZ', 'now');
+			END`,
+		},
+	},
+}
+
+func migrateSQL(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`); err != nil {
+		return err
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for _, m := range sqlMigrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applySQLMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+	return nil
+}
+
+func applySQLMigration(db *sql.DB, m sqlMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLMigrationsAreIdempotent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.db")
+
+	db, err := OpenSQLite(path)
+	require.NoError(t, err)
+	repo, err := NewSQLBookRepository(db)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateBook(testCtx, newTestBook("111")))
+	require.NoError(t, db.Close())
+
+	db, err = OpenSQLite(path)
+	require.NoError(t, err)
+	defer db.Close()
+	repo, err = NewSQLBookRepository(db)
+	require.NoError(t, err)
+
+	books, err := repo.GetAllBooks(testCtx)
+	require.NoError(t, err)
+	assert.Len(t, books, 1)
+
+	var version int
+	require.NoError(t, db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, sqlMigrations[len(sqlMigrations)-1].version, version)
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrBackupsDisabled = errors.New("backups are not enabled")
+)
+
+// backupTimeFormat sorts lexically in time order and is safe in file names.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+type BackupInfo struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Backups keeps rotating, timestamped copies of a data file in dir. A copy
+// named "<base>-<timestamp><ext>" is taken before the file is overwritten,
+// at most once per minInterval, and only the newest retain copies are kept.
+type Backups struct {
+	dir         string
+	base        string
+	ext         string
+	retain      int
+	minInterval time.Duration
+
+	mu       sync.Mutex
+	lastSave time.Time
+}
+
+func NewBackups(dir, dataFilePath string, retain int, minInterval time.Duration) (*Backups, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	name := filepath.Base(dataFilePath)
+	ext := filepath.Ext(name)
+	return &Backups{
+		dir:         dir,
+		base:        strings.TrimSuffix(name, ext),
+		ext:         ext,
+		retain:      retain,
+		minInterval: minInterval,
+	}, nil
+}
+
+// SaveIfDue stores data as a new backup unless the previous one is younger
+// than minInterval.
+func (b *Backups) SaveIfDue(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.minInterval > 0 && time.Since(b.lastSave) < b.minInterval {
+		return nil
+	}
+	return b.save(data)
+}
+
+// Save stores data as a new backup and prunes old backups beyond the
+// retention count.
+func (b *Backups) Save(data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.save(data)
+}
+
+func (b *Backups) save(data []byte) error {
+	now := time.Now().UTC()
+	name := b.base + "-" + now.Format(backupTimeFormat) + b.ext
+	if err := writeFileAtomic(filepath.Join(b.dir, name), data); err != nil {
+		return err
+	}
+	b.lastSave = now
+
+	return b.prune()
+}
+
+// List returns the available backups, newest first.
+func (b *Backups) List() ([]BackupInfo, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []BackupInfo
+	for _, entry := range entries {
+		createdAt, ok := b.parseName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, BackupInfo{Name: entry.Name(), Size: info.Size(), CreatedAt: createdAt})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// Read returns the contents of the named backup. Only names produced by Save
+// are accepted, so the name cannot be used to reach other files.
+func (b *Backups) Read(name string) ([]byte, error) {
+	if _, ok := b.parseName(name); !ok || filepath.Base(name) != name {
+		return nil, ErrBackupNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(b.dir, name))
+	if os.IsNotExist(err) {
+		return nil, ErrBackupNotFound
+	}
+	return data, err
+}
+
+func (b *Backups) prune() error {
+	if b.retain <= 0 {
+		return nil
+	}
+
+	backups, err := b.List()
+	if err != nil {
+		return err
+	}
+	for _, old := range backups[min(b.retain, len(backups)):] {
+		if err := os.Remove(filepath.Join(b.dir, old.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Backups) parseName(name string) (time.Time, bool) {
+	prefix := b.base + "-"
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, b.ext) {
+		return time.Time{}, false
+	}
+
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), b.ext)
+	createdAt, err := time.Parse(backupTimeFormat, stamp)
+	return createdAt, err == nil
+}
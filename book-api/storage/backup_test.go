@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"book-api/models"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackedUpStore(t *testing.T, retain int) (*FileStore, *Backups) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	backups, err := NewBackups(filepath.Join(dir, "backups"), path, retain, 0)
+	require.NoError(t, err)
+	store.EnableBackups(backups)
+	return store, backups
+}
+
+func TestBackupsRotate(t *testing.T) {
+	store, backups := newBackedUpStore(t, 3)
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Version")}))
+	}
+
+	list, err := backups.List()
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.True(t, list[0].CreatedAt.After(list[2].CreatedAt), "newest first")
+	assert.Regexp(t, `^books-\d{8}T\d{6}\.\d{9}Z\.json$`, list[0].Name)
+}
+
+func TestRestoreBackup(t *testing.T) {
+	store, backups := newBackedUpStore(t, 10)
+
+	good := newTestBook("Good catalog")
+	require.NoError(t, store.WriteAll([]*models.Book{good}))
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Bad bulk edit")}))
+
+	list, err := backups.List()
+	require.NoError(t, err)
+	require.NotEmpty(t, list)
+
+	var restored []*models.Book
+	store.OnReload(func(books []*models.Book) { restored = books })
+
+	require.NoError(t, store.RestoreBackup(list[0].Name))
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, good.BookID, books[0].BookID)
+	require.Len(t, restored, 1, "listeners see the restored catalog")
+
+	// The state we rolled back from was kept, so the restore can be undone.
+	after, err := backups.List()
+	require.NoError(t, err)
+	assert.Len(t, after, len(list)+1)
+}
+
+func TestRestoreBackupRejectsBadNamesAndContent(t *testing.T) {
+	store, backups := newBackedUpStore(t, 10)
+
+	assert.ErrorIs(t, store.RestoreBackup("../books.json"), ErrBackupNotFound)
+	assert.ErrorIs(t, store.RestoreBackup("books-20200101T000000.000000000Z.json"), ErrBackupNotFound)
+
+	require.NoError(t, os.WriteFile(filepath.Join(backups.dir, "books-20200101T000000.000000000Z.json"),
+		[]byte(`[{"bookId": "1"}]`), 0644))
+	assert.ErrorIs(t, store.RestoreBackup("books-20200101T000000.000000000Z.json"), ErrInvalidCatalog)
+}
+
+func TestBackupsDisabled(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "books.json"), JSONCodec{})
+	require.NoError(t, err)
+
+	_, err = store.Backups()
+	assert.ErrorIs(t, err, ErrBackupsDisabled)
+	assert.ErrorIs(t, store.RestoreBackup("anything"), ErrBackupsDisabled)
+}
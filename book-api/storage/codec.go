@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"book-api/models"
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Codec converts the catalog to and from its on-disk representation. Marshal
+// writes the current SchemaVersion; Unmarshal accepts any older version and
+// migrates it.
+type Codec interface {
+	Marshal(books []*models.Book) ([]byte, error)
+	Unmarshal(data []byte) ([]*models.Book, error)
+	// DetectVersion reports the schema version data was written with.
+	DetectVersion(data []byte) (int, error)
+}
+
+// CodecByName resolves the DATA_FILE_FORMAT setting to a codec.
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "", "json":
+		return JSONCodec{}, nil
+	case "ndjson":
+		return NDJSONCodec{}, nil
+	case "gob":
+		return GobCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown data file format %q", name)
+	}
+}
+
+// JSONCodec writes the catalog as a single indented JSON document,
+// {"schemaVersion": N, "books": [...]}. A bare array is read as version 0.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(books []*models.Book) ([]byte, error) {
+	if books == nil {
+		books = []*models.Book{}
+	}
+	return json.MarshalIndent(fileEnvelope{SchemaVersion: SchemaVersion(), Books: books}, "", "  ")
+}
+
+func (JSONCodec) Unmarshal(data []byte) ([]*models.Book, error) {
+	version, records, err := decodeJSONFile(data)
+	if err != nil {
+		return nil, err
+	}
+	return upgradeBooks(version, records)
+}
+
+func (JSONCodec) DetectVersion(data []byte) (int, error) {
+	version, _, err := decodeJSONFile(data)
+	return version, err
+}
+
+func decodeJSONFile(data []byte) (int, []json.RawMessage, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var records []json.RawMessage
+		err := json.Unmarshal(data, &records)
+		return 0, records, err
+	}
+
+	var env rawEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return 0, nil, err
+	}
+	if env.SchemaVersion == nil {
+		return 0, nil, errors.New("data file is neither a books array nor a versioned envelope")
+	}
+	return *env.SchemaVersion, env.Books, nil
+}
+
+// NDJSONCodec writes one book per line, which keeps diffs small and lets
+// line-oriented tools work on the file. The first line is a
+// {"schemaVersion": N} header; files without one are version 0.
+type NDJSONCodec struct{}
+
+func (NDJSONCodec) Marshal(books []*models.Book) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(map[string]int{"schemaVersion": SchemaVersion()}); err != nil {
+		return nil, err
+	}
+	for _, book := range books {
+		if err := enc.Encode(book); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (NDJSONCodec) Unmarshal(data []byte) ([]*models.Book, error) {
+	version, records, err := decodeNDJSONFile(data)
+	if err != nil {
+		return nil, err
+	}
+	return upgradeBooks(version, records)
+}
+
+func (NDJSONCodec) DetectVersion(data []byte) (int, error) {
+	version, _, err := decodeNDJSONFile(data)
+	return version, err
+}
+
+func decodeNDJSONFile(data []byte) (int, []json.RawMessage, error) {
+	var (
+		version  int
+		records  []json.RawMessage
+		sawFirst bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var record json.RawMessage
+		if err := json.Unmarshal(text, &record); err != nil {
+			return 0, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if !sawFirst {
+			sawFirst = true
+			var header struct {
+				SchemaVersion *int    `json:"schemaVersion"`
+				BookID        *string `json:"bookId"`
+			}
+			if json.Unmarshal(record, &header) == nil && header.SchemaVersion != nil && header.BookID == nil {
+				version = *header.SchemaVersion
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	return version, records, scanner.Err()
+}
+
+// GobCodec is a compact binary encoding; the file is not human-editable.
+// Older files hold a bare []*models.Book and are version 0. Gob decodes into
+// the current struct before migrations run, so they only see fields it still
+// has.
+type GobCodec struct{}
+
+func (GobCodec) Marshal(books []*models.Book) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(fileEnvelope{SchemaVersion: SchemaVersion(), Books: books})
+	return buf.Bytes(), err
+}
+
+func (GobCodec) Unmarshal(data []byte) ([]*models.Book, error) {
+	version, books, err := decodeGobFile(data)
+	if err != nil || version == SchemaVersion() {
+		return books, err
+	}
+
+	records, err := booksToRecords(books)
+	if err != nil {
+		return nil, err
+	}
+	return upgradeBooks(version, records)
+}
+
+func (GobCodec) DetectVersion(data []byte) (int, error) {
+	version, _, err := decodeGobFile(data)
+	return version, err
+}
+
+func decodeGobFile(data []byte) (int, []*models.Book, error) {
+	var env fileEnvelope
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&env); err == nil {
+		if env.SchemaVersion > SchemaVersion() {
+			return 0, nil, fmt.Errorf("%w: file has version %d, this build supports up to %d",
+				ErrUnsupportedSchema, env.SchemaVersion, SchemaVersion())
+		}
+		return env.SchemaVersion, env.Books, nil
+	}
+
+	var books []*models.Book
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&books)
+	return 0, books, err
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"book-api/models"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrEncrypted is returned when an encrypted file is read without keys.
+	ErrEncrypted = errors.New("data file is encrypted but no encryption key is configured")
+	// ErrUnknownKey is returned when none of the configured keys wrote the file.
+	ErrUnknownKey = errors.New("data file is encrypted with a key that is not configured")
+)
+
+// Encrypted files start with encryptionMagic and a format version, followed by
+// the key ID, the nonce and the AES-GCM sealed contents. The header is
+// authenticated as additional data.
+var encryptionMagic = []byte("BKAPIENC")
+
+const (
+	encryptionFormat = 1
+	keyIDSize        = 8
+	headerSize       = 8 + 1 + keyIDSize
+)
+
+// Keyring holds the AES keys for the data file. The first key encrypts; all
+// of them decrypt, so a key can be rotated by putting the new one first and
+// keeping the old one until the file has been written again.
+type Keyring struct {
+	primary [keyIDSize]byte
+	aeads   map[[keyIDSize]byte]cipher.AEAD
+}
+
+// NewKeyring accepts 16, 24 or 32 byte keys for AES-128, -192 or -256.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one encryption key is required")
+	}
+
+	k := &Keyring{aeads: make(map[[keyIDSize]byte]cipher.AEAD, len(keys))}
+	for i, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %d: %w", i+1, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		id := keyID(key)
+		if i == 0 {
+			k.primary = id
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// ParseKeys reads base64 or hex encoded keys separated by commas or
+// whitespace, as found in DATA_ENCRYPTION_KEY or a key file. Lines starting
+// with # are ignored.
+func ParseKeys(text string) ([][]byte, error) {
+	var keys [][]byte
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		}) {
+			key, err := decodeKey(field)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func decodeKey(s string) ([]byte, error) {
+	if len(s) == 64 {
+		if key, err := hex.DecodeString(s); err == nil {
+			return key, nil
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is neither base64 nor 64 hex digits: %w", err)
+	}
+	return key, nil
+}
+
+func keyID(key []byte) [keyIDSize]byte {
+	sum := sha256.Sum256(key)
+	var id [keyIDSize]byte
+	copy(id[:], sum[:])
+	return id
+}
+
+// Seal encrypts plain with the primary key.
+func (k *Keyring) Seal(plain []byte) ([]byte, error) {
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, headerSize+len(nonce)+len(plain)+aead.Overhead())
+	out = append(out, encryptionMagic...)
+	out = append(out, encryptionFormat)
+	out = append(out, k.primary[:]...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, out[:headerSize]), nil
+}
+
+// Open decrypts data written by Seal with any key in the ring.
+func (k *Keyring) Open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("data is not encrypted")
+	}
+	if data[len(encryptionMagic)] != encryptionFormat {
+		return nil, fmt.Errorf("unknown encryption format %d", data[len(encryptionMagic)])
+	}
+
+	var id [keyIDSize]byte
+	copy(id[:], data[len(encryptionMagic)+1:headerSize])
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w (key id %x)", ErrUnknownKey, id)
+	}
+
+	if len(data) < headerSize+aead.NonceSize() {
+		return nil, errors.New("encrypted data is truncated")
+	}
+	nonce := data[headerSize : headerSize+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[headerSize+aead.NonceSize():], data[:headerSize])
+	if err != nil {
+		return nil, fmt.Errorf("decrypting data file: %w", err)
+	}
+	return plain, nil
+}
+
+// IsEncrypted reports whether data was written by Keyring.Seal.
+func IsEncrypted(data []byte) bool {
+	return len(data) >= headerSize && bytes.HasPrefix(data, encryptionMagic)
+}
+
+// EncryptedCodec encrypts the output of another codec. Plain files are still
+// read, so existing data is encrypted the next time it is written.
+type EncryptedCodec struct {
+	Codec Codec
+	Keys  *Keyring
+}
+
+func NewEncryptedCodec(codec Codec, keys *Keyring) EncryptedCodec {
+	return EncryptedCodec{Codec: codec, Keys: keys}
+}
+
+func (c EncryptedCodec) Marshal(books []*models.Book) ([]byte, error) {
+	plain, err := c.Codec.Marshal(books)
+	if err != nil {
+		return nil, err
+	}
+	return c.Keys.Seal(plain)
+}
+
+func (c EncryptedCodec) Unmarshal(data []byte) ([]*models.Book, error) {
+	plain, err := c.open(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.Codec.Unmarshal(plain)
+}
+
+func (c EncryptedCodec) DetectVersion(data []byte) (int, error) {
+	plain, err := c.open(data)
+	if err != nil {
+		return 0, err
+	}
+	return c.Codec.DetectVersion(plain)
+}
+
+func (c EncryptedCodec) open(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	return c.Keys.Open(data)
+}
+
+// EncryptFile encrypts the file at path in place with the primary key. An
+// already encrypted file is re-encrypted, which rotates it to that key.
+func EncryptFile(path string, keys *Keyring) error {
+	return rewriteFile(path, func(data []byte) ([]byte, error) {
+		if IsEncrypted(data) {
+			var err error
+			if data, err = keys.Open(data); err != nil {
+				return nil, err
+			}
+		}
+		return keys.Seal(data)
+	})
+}
+
+// DecryptFile replaces the encrypted file at path with its plain contents.
+// Plain files are left as they are.
+func DecryptFile(path string, keys *Keyring) error {
+	return rewriteFile(path, func(data []byte) ([]byte, error) {
+		if !IsEncrypted(data) {
+			return data, nil
+		}
+		return keys.Open(data)
+	})
+}
+
+// rewriteFile transforms a data file under the same lock FileStore uses, so
+// it is safe while the service runs; the service reloads the result like any
+// other external change.
+func rewriteFile(path string, fn func(data []byte) ([]byte, error)) error {
+	unlock, err := lockPath(path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := fn(data)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(out, data) {
+		return nil
+	}
+
+	if err := writeFileAtomic(path, out); err != nil {
+		return err
+	}
+	return writeChecksum(path, sha256.Sum256(out))
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"book-api/models"
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKey(t *testing.T) []byte {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+func newTestKeyring(t *testing.T, keys ...[]byte) *Keyring {
+	keyring, err := NewKeyring(keys...)
+	require.NoError(t, err)
+	return keyring
+}
+
+func TestEncryptedFileStore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	key := newTestKey(t)
+
+	// An existing plain file still loads and is encrypted on the next write.
+	plain, err := JSONCodec{}.Marshal([]*models.Book{newTestBook("Unpublished")})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, plain, 0644))
+
+	store, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, key)))
+	require.NoError(t, err)
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+
+	require.NoError(t, store.WriteAll(books))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(data))
+	assert.False(t, bytes.Contains(data, []byte("Unpublished")))
+
+	reopened, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, key)))
+	require.NoError(t, err)
+	books, err = reopened.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Unpublished", books[0].Title)
+	assert.True(t, reopened.IntegrityStatus().Verified)
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+
+	store, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, oldKey)))
+	require.NoError(t, err)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Rotated")}))
+
+	rotated, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, newKey, oldKey)))
+	require.NoError(t, err)
+	books, err := rotated.ReadAll()
+	require.NoError(t, err)
+	require.NoError(t, rotated.WriteAll(books))
+
+	// Once written again the old key is no longer needed.
+	newOnly, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, newKey)))
+	require.NoError(t, err)
+	books, err = newOnly.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Rotated", books[0].Title)
+}
+
+func TestEncryptedFileWithoutKeyIsNotQuarantined(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	store, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, newTestKey(t))))
+	require.NoError(t, err)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Secret")}))
+
+	plainStore, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	_, err = plainStore.ReadAll()
+	assert.ErrorIs(t, err, ErrEncrypted)
+
+	otherKey, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, newTestKey(t))))
+	require.NoError(t, err)
+	_, err = otherKey.ReadAll()
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	assert.Empty(t, quarantinedFiles(t, dir))
+}
+
+func TestTamperedEncryptedFileIsCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	store, err := NewFileStore(path, NewEncryptedCodec(JSONCodec{}, newTestKeyring(t, newTestKey(t))))
+	require.NoError(t, err)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Good")}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-1] ^= 0xff
+	editExternally(t, path, data)
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Good", books[0].Title)
+	assert.Len(t, quarantinedFiles(t, dir), 1)
+}
+
+func TestEncryptAndDecryptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	plain, err := JSONCodec{}.Marshal([]*models.Book{newTestBook("CLI")})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, plain, 0644))
+
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	require.NoError(t, EncryptFile(path, newTestKeyring(t, oldKey)))
+	encrypted, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+
+	// Encrypting again rotates to the first key.
+	require.NoError(t, EncryptFile(path, newTestKeyring(t, newKey, oldKey)))
+	require.NoError(t, DecryptFile(path, newTestKeyring(t, newKey)))
+
+	decrypted, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, plain, decrypted)
+
+	// The checksum sidecar follows the rewrite.
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	_, err = store.ReadAll()
+	require.NoError(t, err)
+	assert.True(t, store.IntegrityStatus().Verified)
+}
+
+func TestParseKeys(t *testing.T) {
+	a, b := newTestKey(t), newTestKey(t)
+	text := "# current key first\n" + base64.StdEncoding.EncodeToString(a) + "\n" +
+		hex.EncodeToString(b) + ", " + base64.StdEncoding.EncodeToString(b) + "\n"
+
+	keys, err := ParseKeys(text)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{a, b, b}, keys)
+
+	_, err = ParseKeys("not-a-key!")
+	assert.Error(t, err)
+
+	_, err = NewKeyring([]byte("short"))
+	assert.Error(t, err)
+}
@@ -2,54 +2,481 @@ package storage
 
 import (
 	"book-api/models"
-	"encoding/json"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
+// FileStore keeps the catalog in a single file. Access is serialised inside
+// the process by mu and across processes by an advisory flock on
+// "<file>.lock", so several replicas can share one data file.
+//
+// The last decoded catalog is cached together with the file's stat info and
+// checksum. Every read re-stats the file; if another process replaced or
+// edited it the contents are re-read and, when the checksum differs, decoded
+// again. Content this store did not write itself must pass validateCatalog
+// before it is served; otherwise it is rejected, the last good catalog keeps
+// being served, and the rejection shows up in ReloadStatus.
+//
+// Each write also records the file's checksum in a sidecar. Content that no
+// longer decodes or no longer matches the checksum, or a file truncated to
+// nothing, is corrupt: it is quarantined and replaced with the last good
+// catalog (see recoverCorrupt), and IntegrityStatus reports it. Hand edits
+// therefore need AcceptHandEdits, or the sidecar removed along with the edit.
 type FileStore struct {
 	filePath string
+	lockPath string
+	codec    Codec
 	mu       sync.RWMutex
+
+	cacheMu   sync.Mutex
+	cached    []*models.Book
+	cacheInfo os.FileInfo
+	cacheSum  [sha256.Size]byte
+	rejectSum [sha256.Size]byte
+	status    ReloadStatus
+	integrity IntegrityStatus
+	backups   *Backups
+	handEdits bool
+
+	notifyMu  sync.Mutex
+	listeners []func(books []*models.Book)
 }
 
-func NewFileStore(filePath string) *FileStore {
+// NewFileStore opens the catalog at filePath, creating the file and its parent
+// directory when missing.
+func NewFileStore(filePath string, codec Codec) (*FileStore, error) {
+	fs := &FileStore{filePath: filePath, lockPath: filePath + ".lock", codec: codec}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, err
+	}
+
+	unlock, err := lockPath(fs.lockPath, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		os.WriteFile(filePath, []byte("[]"), 0644)
+		if err := fs.write(nil); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
 	}
-	return &FileStore{filePath: filePath}
+
+	return fs, nil
 }
 
 func (fs *FileStore) ReadAll() ([]*models.Book, error) {
+	books, reloaded, err := fs.readShared()
+	if errors.Is(err, errCorruptFile) {
+		// Recovery rewrites the file, which needs the write locks.
+		books, reloaded, err = fs.readExclusive()
+	}
+	if reloaded {
+		fs.notify()
+	}
+	return books, err
+}
+
+func (fs *FileStore) readShared() ([]*models.Book, bool, error) {
 	fs.mu.RLock()
 	defer fs.mu.RUnlock()
 
-	data, err := os.ReadFile(fs.filePath)
+	unlock, err := lockPath(fs.lockPath, false)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
+	defer unlock()
 
-	var books []*models.Book
-	if len(data) == 0 {
-		return books, nil
+	return fs.read()
+}
+
+func (fs *FileStore) readExclusive() ([]*models.Book, bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	unlock, err := lockPath(fs.lockPath, true)
+	if err != nil {
+		return nil, false, err
 	}
+	defer unlock()
 
-	err = json.Unmarshal(data, &books)
-	return books, err
+	return fs.readOrRecover()
 }
 
 func (fs *FileStore) WriteAll(books []*models.Book) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
-	data, err := json.MarshalIndent(books, "", "  ")
+	unlock, err := lockPath(fs.lockPath, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return fs.write(books)
+}
+
+// Update runs a read-modify-write cycle while holding the write lock, so no
+// other reader or writer can observe or overwrite the intermediate state.
+// If fn returns an error nothing is written.
+func (fs *FileStore) Update(fn func(books []*models.Book) ([]*models.Book, error)) error {
+	reloaded, err := fs.update(fn)
+	if reloaded {
+		fs.notify()
+	}
+	return err
+}
+
+func (fs *FileStore) update(fn func(books []*models.Book) ([]*models.Book, error)) (bool, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	unlock, err := lockPath(fs.lockPath, true)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	books, reloaded, err := fs.readOrRecover()
+	if err != nil {
+		return reloaded, err
+	}
+
+	books, err = fn(books)
+	if err != nil {
+		return reloaded, err
+	}
+
+	return reloaded, fs.write(books)
+}
+
+// EnableBackups makes every write first copy the current file into b.
+func (fs *FileStore) EnableBackups(b *Backups) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.backups = b
+}
+
+// AcceptHandEdits makes a data file that decodes but no longer matches its
+// checksum an external edit rather than corruption. Once the edit passes
+// validation its checksum is recorded again.
+func (fs *FileStore) AcceptHandEdits(accept bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	fs.handEdits = accept
+}
+
+func (fs *FileStore) Backups() ([]BackupInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if fs.backups == nil {
+		return nil, ErrBackupsDisabled
+	}
+	return fs.backups.List()
+}
+
+// RestoreBackup replaces the catalog with the named backup. The backup must
+// decode and pass validateCatalog; the state being replaced is itself backed
+// up first, so a restore can be undone. Reload listeners are notified.
+func (fs *FileStore) RestoreBackup(name string) error {
+	if err := fs.restoreBackup(name); err != nil {
+		return err
+	}
+	fs.notify()
+	return nil
+}
+
+func (fs *FileStore) restoreBackup(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.backups == nil {
+		return ErrBackupsDisabled
+	}
+	data, err := fs.backups.Read(name)
 	if err != nil {
 		return err
 	}
 
-	tmpPath := fs.filePath + ".tmp"
+	var books []*models.Book
+	if len(bytes.TrimSpace(data)) > 0 {
+		if books, err = fs.codec.Unmarshal(data); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCatalog, err)
+		}
+	}
+	if err := validateCatalog(books); err != nil {
+		return err
+	}
+
+	unlock, err := lockPath(fs.lockPath, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := fs.backupCurrent(true); err != nil {
+		return err
+	}
+	return fs.writeFile(books)
+}
+
+// OnReload registers fn to be called with the new catalog whenever an
+// external change to the file is accepted. Callbacks run outside the store's
+// locks, one at a time, and always receive the newest accepted catalog.
+func (fs *FileStore) OnReload(fn func(books []*models.Book)) {
+	fs.notifyMu.Lock()
+	defer fs.notifyMu.Unlock()
+
+	fs.listeners = append(fs.listeners, fn)
+}
+
+// Watch polls the file every interval so that external edits are detected,
+// validated and announced even when no request touches the store. The
+// returned func stops the poller.
+func (fs *FileStore) Watch(interval time.Duration) func() {
+	fs.cacheMu.Lock()
+	fs.status.WatchInterval = interval.String()
+	fs.cacheMu.Unlock()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := fs.ReadAll(); err != nil {
+					log.Printf("Data file check failed: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// Modified is the data file's modification time: every write replaces the
+// file, and so does an external edit.
+func (fs *FileStore) Modified() (time.Time, error) {
+	return latestModTime(fs.filePath)
+}
+
+func (fs *FileStore) ReloadStatus() ReloadStatus {
+	fs.cacheMu.Lock()
+	defer fs.cacheMu.Unlock()
+
+	return fs.status
+}
+
+func (fs *FileStore) IntegrityStatus() IntegrityStatus {
+	fs.cacheMu.Lock()
+	defer fs.cacheMu.Unlock()
+
+	return fs.integrity
+}
+
+func (fs *FileStore) notify() {
+	fs.notifyMu.Lock()
+	defer fs.notifyMu.Unlock()
+
+	if len(fs.listeners) == 0 {
+		return
+	}
+	fs.cacheMu.Lock()
+	books := fs.cached
+	fs.cacheMu.Unlock()
+
+	for _, fn := range fs.listeners {
+		fn(cloneBooks(books))
+	}
+}
+
+// readOrRecover is read for callers holding the write locks; a corrupt file
+// is recovered from instead of reported.
+func (fs *FileStore) readOrRecover() ([]*models.Book, bool, error) {
+	books, reloaded, err := fs.read()
+	if errors.Is(err, errCorruptFile) {
+		books, err = fs.recoverCorrupt(err)
+	}
+	return books, reloaded, err
+}
+
+// read returns a private copy of the catalog, using the cache when the file
+// has not changed since it was last read or written. The flag reports whether
+// an external change was accepted. Corrupt content is reported as
+// errCorruptFile and leaves the cache untouched.
+func (fs *FileStore) read() ([]*models.Book, bool, error) {
+	info, err := os.Stat(fs.filePath)
+
+	fs.cacheMu.Lock()
+	defer fs.cacheMu.Unlock()
+
+	if os.IsNotExist(err) && fs.integrity.Degraded {
+		// The corrupt file was quarantined and nothing has replaced it yet.
+		fs.status.LastChecked = time.Now()
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	fs.status.LastChecked = time.Now()
+	if fs.cacheInfo != nil && sameFileVersion(fs.cacheInfo, info) {
+		return cloneBooks(fs.cached), false, nil
+	}
+
+	data, err := os.ReadFile(fs.filePath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sum := sha256.Sum256(data)
+	if fs.cacheInfo != nil && (sum == fs.cacheSum || sum == fs.rejectSum) {
+		// Touched, rewritten with identical content, or already rejected.
+		fs.cacheInfo = info
+		return cloneBooks(fs.cached), false, nil
+	}
+
+	books, verified, err := decodeChecked(fs.codec, fs.filePath, data, sum, fs.handEdits)
+	if err != nil {
+		return nil, false, err
+	}
+	err = validateCatalog(books)
+
+	// A degraded store has nothing loaded, but a good file showing up is
+	// announced like any other external change.
+	firstLoad := fs.cacheInfo == nil && !fs.integrity.Degraded
+	if err != nil && !firstLoad {
+		fs.cacheInfo, fs.rejectSum = info, sum
+		now := time.Now()
+		fs.status.LastRejected = &now
+		fs.status.LastError = err.Error()
+		fs.status.Rejections++
+		log.Printf("Rejected external change to %s, keeping previous catalog: %v", fs.filePath, err)
+		return cloneBooks(fs.cached), false, nil
+	}
+	if err != nil {
+		if books == nil {
+			return nil, false, err
+		}
+		// Nothing older to fall back to; serve what is there but say so.
+		fs.status.LastError = err.Error()
+		log.Printf("WARNING: %s failed validation on load: %v", fs.filePath, err)
+	}
+
+	if !verified && err == nil && fs.handEdits {
+		verified = fs.restamp(sum)
+	}
+	fs.cached, fs.cacheInfo, fs.cacheSum = books, info, sum
+	fs.status.BookCount = len(books)
+	fs.integrity.Verified = verified
+	if err == nil {
+		fs.integrity.Degraded = false
+	}
+	if firstLoad {
+		return cloneBooks(books), false, nil
+	}
+
+	now := time.Now()
+	fs.status.LastReload = &now
+	fs.status.LastError = ""
+	fs.status.Reloads++
+	log.Printf("Reloaded %d books from externally modified %s", len(books), fs.filePath)
+	return cloneBooks(books), true, nil
+}
+
+func (fs *FileStore) write(books []*models.Book) error {
+	fs.cacheMu.Lock()
+	degraded := fs.integrity.Degraded
+	fs.cacheMu.Unlock()
+	if degraded {
+		return ErrReadOnly
+	}
+
+	if err := fs.backupCurrent(false); err != nil {
+		return fmt.Errorf("backup before write failed: %w", err)
+	}
+	return fs.writeFile(books)
+}
+
+// backupCurrent copies the file as it is on disk into the backups, if enabled.
+func (fs *FileStore) backupCurrent(force bool) error {
+	if fs.backups == nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(fs.filePath)
+	if os.IsNotExist(err) || (err == nil && len(bytes.TrimSpace(data)) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if force {
+		return fs.backups.Save(data)
+	}
+	return fs.backups.SaveIfDue(data)
+}
+
+func (fs *FileStore) writeFile(books []*models.Book) error {
+	data, err := fs.codec.Marshal(books)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(fs.filePath, data); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if err := writeChecksum(fs.filePath, sum); err != nil {
+		return err
+	}
+
+	fs.cacheMu.Lock()
+	defer fs.cacheMu.Unlock()
+
+	fs.cached, fs.cacheSum = cloneBooks(books), sum
+	fs.status.BookCount = len(books)
+	fs.integrity.Verified, fs.integrity.Degraded = true, false
+	if fs.cacheInfo, err = os.Stat(fs.filePath); err != nil {
+		fs.cacheInfo = nil
+	}
+	return nil
+}
+
+func sameFileVersion(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path so
+// readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmpPath := path + ".tmp"
 	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
 		return err
 	}
 
-	return os.Rename(tmpPath, fs.filePath)
+	return os.Rename(tmpPath, path)
 }
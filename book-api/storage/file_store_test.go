@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"book-api/models"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBook returns a book that passes validation, with a unique ISBN.
+func newTestBook(title string) *models.Book {
+	book := models.NewBook()
+	book.Title = title
+	book.AuthorID = "author1"
+	book.PublisherID = "pub1"
+	book.ISBN = book.BookID
+	book.Pages = 100
+	book.Price = 9.99
+	return book
+}
+
+func TestFileStoreCodecsRoundTrip(t *testing.T) {
+	codecs := map[string]Codec{
+		"json":   JSONCodec{},
+		"ndjson": NDJSONCodec{},
+		"gob":    GobCodec{},
+	}
+
+	for name, codec := range codecs {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			store, err := NewFileStore(filepath.Join(t.TempDir(), "books."+name), codec)
+			require.NoError(t, err)
+
+			books, err := store.ReadAll()
+			require.NoError(t, err)
+			assert.Empty(t, books)
+
+			book := newTestBook("Round Trip")
+			book.Description = "line one\nline two"
+			book.Price = 12.5
+			require.NoError(t, store.WriteAll([]*models.Book{book}))
+
+			books, err = store.ReadAll()
+			require.NoError(t, err)
+			require.Len(t, books, 1)
+			assert.Equal(t, book.BookID, books[0].BookID)
+			assert.Equal(t, book.Description, books[0].Description)
+			assert.True(t, book.CreatedAt.Equal(books[0].CreatedAt))
+		})
+	}
+}
+
+func TestNewFileStoreCreatesParentDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "books.json")
+
+	_, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"schemaVersion": %d, "books": []}`, SchemaVersion()), string(data))
+}
+
+func TestCodecByName(t *testing.T) {
+	codec, err := CodecByName("ndjson")
+	require.NoError(t, err)
+	assert.IsType(t, NDJSONCodec{}, codec)
+
+	_, err = CodecByName("xml")
+	assert.Error(t, err)
+}
+
+func TestFileStoresShareOneFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+
+	// Two stores stand in for two processes: they share nothing but the file
+	// and its lock, so only flock keeps their updates from clobbering.
+	first, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	second, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+
+	const perStore = 25
+	var wg sync.WaitGroup
+	for _, store := range []*FileStore{first, second} {
+		for i := 0; i < perStore; i++ {
+			wg.Add(1)
+			go func(store *FileStore) {
+				defer wg.Done()
+				assert.NoError(t, store.Update(func(books []*models.Book) ([]*models.Book, error) {
+					return append(books, newTestBook("Shared")), nil
+				}))
+			}(store)
+		}
+	}
+	wg.Wait()
+
+	for _, store := range []*FileStore{first, second} {
+		books, err := store.ReadAll()
+		require.NoError(t, err)
+		assert.Len(t, books, 2*perStore)
+	}
+}
+
+func TestFileStoreReloadsExternalChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+
+	store.AcceptHandEdits(true)
+
+	book := newTestBook("Original")
+	require.NoError(t, store.WriteAll([]*models.Book{book}))
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+
+	// Edit the file in place, the way a text editor or another process would.
+	book.Title = "Edited elsewhere"
+	data, err := JSONCodec{}.Marshal([]*models.Book{book})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+
+	books, err = store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Edited elsewhere", books[0].Title)
+}
+
+func TestFileStoreReadAllReturnsCopies(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "books.json"), JSONCodec{})
+	require.NoError(t, err)
+	book := newTestBook("Cached")
+	require.NoError(t, store.WriteAll([]*models.Book{book}))
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	books[0].Title = "Changed by caller"
+
+	books, err = store.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Cached", books[0].Title)
+}
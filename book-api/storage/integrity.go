@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"book-api/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrReadOnly is returned for writes while the store is degraded: the data
+// file was corrupt and no good copy of the catalog could be found.
+var ErrReadOnly = errors.New("catalog is read-only: data file is corrupt and no good copy was found")
+
+var errCorruptFile = errors.New("data file is corrupt")
+
+// IntegrityStatus reports whether the data file matched its checksum when it
+// was last loaded and what happened the last time it was found corrupt.
+type IntegrityStatus struct {
+	Verified       bool       `json:"verified"`
+	Degraded       bool       `json:"degraded"`
+	Corruptions    int        `json:"corruptions"`
+	LastCorruption *time.Time `json:"lastCorruption,omitempty"`
+	LastError      string     `json:"lastError,omitempty"`
+	Quarantined    string     `json:"quarantined,omitempty"`
+	RecoveredFrom  string     `json:"recoveredFrom,omitempty"`
+}
+
+// checksumPath is the sidecar holding the SHA-256 of the data file in
+// sha256sum format, so it can also be checked by hand.
+func checksumPath(path string) string {
+	return path + ".sha256"
+}
+
+func writeChecksum(path string, sum [sha256.Size]byte) error {
+	line := hex.EncodeToString(sum[:]) + "  " + filepath.Base(path) + "\n"
+	return writeFileAtomic(checksumPath(path), []byte(line))
+}
+
+// readChecksum returns the recorded checksum; ok is false when there is no
+// readable sidecar.
+func readChecksum(path string) (sum [sha256.Size]byte, ok bool) {
+	data, err := os.ReadFile(checksumPath(path))
+	if err != nil {
+		return sum, false
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return sum, false
+	}
+	decoded, err := hex.DecodeString(fields[0])
+	if err != nil || len(decoded) != sha256.Size {
+		return sum, false
+	}
+	copy(sum[:], decoded)
+	return sum, true
+}
+
+// decodeChecked decodes data read from path. Content that does not decode is
+// corrupt, and so is content that no longer matches its recorded checksum:
+// bit rot or a partial copy can still decode. With acceptEdits a mismatch that
+// decodes is taken to be a hand edit and returned unverified; an empty file
+// whose checksum says it should not be is corrupt either way, since a file
+// truncated to nothing would otherwise load as an empty catalog. A file from a
+// schema version this build cannot load, or encrypted with a key it does not
+// have, is reported but not corrupt.
+func decodeChecked(codec Codec, path string, data []byte, sum [sha256.Size]byte, acceptEdits bool) (books []*models.Book, verified bool, err error) {
+	recorded, hasChecksum := readChecksum(path)
+	verified = hasChecksum && recorded == sum
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if hasChecksum && !verified {
+			return nil, false, fmt.Errorf("%w: file is empty but its checksum does not match", errCorruptFile)
+		}
+		return nil, verified, nil
+	}
+	if hasChecksum && !verified && !acceptEdits {
+		return nil, false, fmt.Errorf("%w: content does not match its checksum", errCorruptFile)
+	}
+
+	if _, ok := codec.(EncryptedCodec); !ok && IsEncrypted(data) {
+		return nil, false, ErrEncrypted
+	}
+	books, err = codec.Unmarshal(data)
+	if errors.Is(err, ErrUnsupportedSchema) || errors.Is(err, ErrMigrationFailed) || errors.Is(err, ErrUnknownKey) {
+		// Well-formed but not loadable by this build; leave the file alone.
+		return nil, false, err
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("%w: %v", errCorruptFile, err)
+	}
+	return books, verified, nil
+}
+
+// restamp records sum as the checksum of an accepted hand edit and reports
+// whether it could. The caller must hold the file lock.
+func (fs *FileStore) restamp(sum [sha256.Size]byte) bool {
+	if err := writeChecksum(fs.filePath, sum); err != nil {
+		log.Printf("Recording the checksum of edited %s failed: %v", fs.filePath, err)
+		return false
+	}
+	return true
+}
+
+// recoverCorrupt moves the corrupt data file aside and replaces it with the
+// last good catalog: the one in memory if this store has loaded one, otherwise
+// the newest backup that decodes and validates. With neither the store stays
+// up in read-only degraded mode serving an empty catalog. The caller must hold
+// the write locks.
+func (fs *FileStore) recoverCorrupt(cause error) ([]*models.Book, error) {
+	quarantined, err := fs.quarantine()
+	if err != nil {
+		return nil, fmt.Errorf("quarantining %s failed: %w (%v)", fs.filePath, err, cause)
+	}
+	log.Printf("Data file %s is corrupt, moved it to %s: %v", fs.filePath, quarantined, cause)
+
+	fs.cacheMu.Lock()
+	books, source := fs.cached, ""
+	if fs.cacheInfo != nil {
+		source = "memory"
+	}
+	now := time.Now()
+	fs.integrity.Corruptions++
+	fs.integrity.LastCorruption = &now
+	fs.integrity.LastError = cause.Error()
+	fs.integrity.Quarantined = filepath.Base(quarantined)
+	fs.cacheMu.Unlock()
+
+	if source == "" {
+		books, source = fs.lastGoodBackup()
+	}
+	if source == "" {
+		fs.cacheMu.Lock()
+		fs.cached, fs.cacheInfo = nil, nil
+		fs.status.BookCount = 0
+		fs.integrity.Degraded, fs.integrity.Verified = true, false
+		fs.integrity.RecoveredFrom = ""
+		fs.cacheMu.Unlock()
+		log.Printf("WARNING: no good copy of %s found, serving an empty catalog read-only", fs.filePath)
+		return nil, nil
+	}
+
+	if err := fs.writeFile(books); err != nil {
+		return nil, err
+	}
+	fs.cacheMu.Lock()
+	fs.integrity.RecoveredFrom = source
+	fs.cacheMu.Unlock()
+	log.Printf("Restored %d books to %s from %s", len(books), fs.filePath, source)
+	return cloneBooks(books), nil
+}
+
+// quarantine renames the data file to "<base>.corrupt-<timestamp><ext>" next
+// to it and returns the new path. Its checksum goes along, so a good file put
+// back by hand is not held against the checksum of the one it replaces.
+func (fs *FileStore) quarantine() (string, error) {
+	name := filepath.Base(fs.filePath)
+	ext := filepath.Ext(name)
+	stamp := time.Now().UTC().Format(backupTimeFormat)
+	target := filepath.Join(filepath.Dir(fs.filePath), strings.TrimSuffix(name, ext)+".corrupt-"+stamp+ext)
+
+	if err := os.Rename(fs.filePath, target); err != nil {
+		return target, err
+	}
+	if err := os.Rename(checksumPath(fs.filePath), checksumPath(target)); err != nil && !os.IsNotExist(err) {
+		return target, err
+	}
+	return target, nil
+}
+
+// lastGoodBackup returns the newest backup that decodes and validates and its
+// name, or an empty name when there is none.
+func (fs *FileStore) lastGoodBackup() ([]*models.Book, string) {
+	if fs.backups == nil {
+		return nil, ""
+	}
+	backups, err := fs.backups.List()
+	if err != nil {
+		log.Printf("Listing backups failed: %v", err)
+		return nil, ""
+	}
+
+	for _, backup := range backups {
+		data, err := fs.backups.Read(backup.Name)
+		if err != nil {
+			continue
+		}
+		var books []*models.Book
+		if len(bytes.TrimSpace(data)) > 0 {
+			if books, err = fs.codec.Unmarshal(data); err != nil {
+				continue
+			}
+		}
+		if validateCatalog(books) == nil {
+			return books, "backup " + backup.Name
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"book-api/models"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func quarantinedFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "books.corrupt-*.json"))
+	require.NoError(t, err)
+	return matches
+}
+
+func TestFileStoreWritesChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Checked")}))
+
+	sidecar, err := os.ReadFile(checksumPath(path))
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(sidecar), "  books.json\n"))
+	assert.True(t, store.IntegrityStatus().Verified)
+}
+
+func TestFileStoreQuarantinesChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Good")}))
+
+	// Still decodes and validates, but is not what was written.
+	changed, err := JSONCodec{}.Marshal([]*models.Book{newTestBook("Rotted")})
+	require.NoError(t, err)
+	editExternally(t, path, changed)
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Good", books[0].Title)
+
+	quarantined := quarantinedFiles(t, dir)
+	require.Len(t, quarantined, 1)
+	data, err := os.ReadFile(quarantined[0])
+	require.NoError(t, err)
+	assert.Equal(t, changed, data)
+	_, err = os.Stat(checksumPath(quarantined[0]))
+	assert.NoError(t, err)
+
+	status := store.IntegrityStatus()
+	assert.Equal(t, 1, status.Corruptions)
+	assert.Contains(t, status.LastError, "does not match its checksum")
+	assert.Equal(t, "memory", status.RecoveredFrom)
+	assert.True(t, status.Verified)
+}
+
+func TestFileStoreAcceptsHandEditsWhenEnabled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	store.AcceptHandEdits(true)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Checked")}))
+
+	data, err := JSONCodec{}.Marshal([]*models.Book{newTestBook("Edited")})
+	require.NoError(t, err)
+	editExternally(t, path, data)
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", books[0].Title)
+	assert.Empty(t, quarantinedFiles(t, dir))
+
+	// The edit's checksum was recorded, so a store without the opt-in
+	// verifies it.
+	other, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	books, err = other.ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, "Edited", books[0].Title)
+	assert.True(t, other.IntegrityStatus().Verified)
+	assert.Zero(t, other.IntegrityStatus().Corruptions)
+}
+
+func TestFileStoreQuarantinesCorruptFile(t *testing.T) {
+	for name, corrupt := range map[string][]byte{
+		"invalid json": []byte(`[{"bookId": "broken"`),
+		"truncated":    {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "books.json")
+			store, err := NewFileStore(path, JSONCodec{})
+			require.NoError(t, err)
+			require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Good")}))
+
+			editExternally(t, path, corrupt)
+
+			books, err := store.ReadAll()
+			require.NoError(t, err)
+			require.Len(t, books, 1)
+			assert.Equal(t, "Good", books[0].Title)
+
+			quarantined := quarantinedFiles(t, dir)
+			require.Len(t, quarantined, 1)
+			data, err := os.ReadFile(quarantined[0])
+			require.NoError(t, err)
+			assert.Equal(t, corrupt, data)
+
+			// The last good catalog was written back and verifies again.
+			other, err := NewFileStore(path, JSONCodec{})
+			require.NoError(t, err)
+			books, err = other.ReadAll()
+			require.NoError(t, err)
+			assert.Equal(t, "Good", books[0].Title)
+			assert.True(t, other.IntegrityStatus().Verified)
+
+			status := store.IntegrityStatus()
+			assert.Equal(t, 1, status.Corruptions)
+			assert.Equal(t, "memory", status.RecoveredFrom)
+			assert.Equal(t, filepath.Base(quarantined[0]), status.Quarantined)
+			assert.False(t, status.Degraded)
+			assert.Zero(t, store.ReloadStatus().Rejections)
+		})
+	}
+}
+
+func TestFileStoreRecoversCorruptFileFromBackup(t *testing.T) {
+	store, backups := newBackedUpStore(t, 5)
+	path := store.filePath
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("First")}))
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Second")}))
+	require.NoError(t, os.WriteFile(path, []byte("not json"), 0644))
+
+	// A freshly started store has nothing in memory to fall back to.
+	restarted, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	restarted.EnableBackups(backups)
+
+	books, err := restarted.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "First", books[0].Title)
+
+	status := restarted.IntegrityStatus()
+	assert.True(t, strings.HasPrefix(status.RecoveredFrom, "backup books-"))
+	assert.False(t, status.Degraded)
+	require.NoError(t, restarted.WriteAll([]*models.Book{newTestBook("Third")}))
+}
+
+func TestFileStoreDegradedWithoutGoodCopy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	require.NoError(t, os.WriteFile(path, []byte("{{{"), 0644))
+
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	assert.Empty(t, books)
+	assert.True(t, store.IntegrityStatus().Degraded)
+	assert.Len(t, quarantinedFiles(t, dir), 1)
+
+	assert.ErrorIs(t, store.WriteAll([]*models.Book{newTestBook("Refused")}), ErrReadOnly)
+	assert.ErrorIs(t, store.Update(func(books []*models.Book) ([]*models.Book, error) {
+		return books, nil
+	}), ErrReadOnly)
+
+	// Putting a good file back in place ends degraded mode.
+	data, err := JSONCodec{}.Marshal([]*models.Book{newTestBook("Fixed")})
+	require.NoError(t, err)
+	editExternally(t, path, data)
+
+	books, err = store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Fixed", books[0].Title)
+	assert.False(t, store.IntegrityStatus().Degraded)
+	require.NoError(t, store.WriteAll(books))
+}
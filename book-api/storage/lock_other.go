@@ -0,0 +1,9 @@
+//go:build !unix
+
+package storage
+
+// lockPath is a no-op where flock is unavailable; only the in-process mutex
+// protects the file there.
+func lockPath(path string, exclusive bool) (func() error, error) {
+	return func() error { return nil }, nil
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"book-api/models"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultCompactEvery is the number of log records between snapshots when
+// NewLogStore is given 0 or less.
+const DefaultCompactEvery = 1000
+
+// LogStore keeps the catalog in memory and persists it as a snapshot file
+// (written with the configured codec) plus an append-only log next to it.
+// Every Update appends a single record describing only the books that
+// changed; the log is replayed over the snapshot on startup and folded into a
+// fresh snapshot every compactEvery records.
+//
+// Each log line is "<crc32 hex> <json>\n". A final line that is incomplete or
+// fails its checksum is treated as a write torn by a crash and truncated away.
+type LogStore struct {
+	snapshotPath string
+	logPath      string
+	codec        Codec
+	compactEvery int
+
+	mu      sync.RWMutex
+	books   []*models.Book
+	logFile *os.File
+	pending int
+}
+
+type logRecord struct {
+	Ops []logOp `json:"ops"`
+}
+
+type logOp struct {
+	Op   string       `json:"op"`
+	ID   string       `json:"id,omitempty"`
+	Book *models.Book `json:"book,omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+var errCorruptLog = errors.New("corrupt write-ahead log")
+
+func NewLogStore(snapshotPath string, codec Codec, compactEvery int) (*LogStore, error) {
+	if compactEvery <= 0 {
+		compactEvery = DefaultCompactEvery
+	}
+	s := &LogStore{
+		snapshotPath: snapshotPath,
+		logPath:      snapshotPath + ".wal",
+		codec:        codec,
+		compactEvery: compactEvery,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(snapshotPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayLog(); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(s.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	s.logFile = f
+	return s, nil
+}
+
+func (s *LogStore) ReadAll() ([]*models.Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return cloneBooks(s.books), nil
+}
+
+// WriteAll replaces the whole catalog, which is done as a compaction.
+func (s *LogStore) WriteAll(books []*models.Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.compact(cloneBooks(books))
+}
+
+func (s *LogStore) Update(fn func(books []*models.Book) ([]*models.Book, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated, err := fn(cloneBooks(s.books))
+	if err != nil {
+		return err
+	}
+
+	ops := diffBooks(s.books, updated)
+	if len(ops) == 0 {
+		return nil
+	}
+	if err := s.appendRecord(logRecord{Ops: ops}); err != nil {
+		return err
+	}
+	s.books = applyOps(s.books, ops)
+
+	s.pending++
+	if s.pending >= s.compactEvery {
+		if err := s.compact(s.books); err != nil {
+			log.Printf("WAL compaction failed, will retry: %v", err)
+		}
+	}
+	return nil
+}
+
+// Modified is the later of the snapshot's and the log's modification times;
+// every change is appended to the log and a compaction rewrites both.
+func (s *LogStore) Modified() (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return latestModTime(s.snapshotPath, s.logPath)
+}
+
+// Close folds the log into the snapshot and releases the log file.
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.compact(s.books)
+	if closeErr := s.logFile.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s *LogStore) loadSnapshot() error {
+	data, err := os.ReadFile(s.snapshotPath)
+	if os.IsNotExist(err) || (err == nil && len(data) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.books, err = s.codec.Unmarshal(data)
+	return err
+}
+
+func (s *LogStore) replayLog() error {
+	f, err := os.OpenFile(s.logPath, os.O_RDWR, 0644)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	var good int64
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(line) == 0 && readErr == io.EOF {
+			break
+		}
+		if readErr != nil && readErr != io.EOF {
+			return readErr
+		}
+
+		record, err := decodeLogLine(line)
+		if err != nil || readErr == io.EOF {
+			// Anything after a bad record means the log is damaged, not torn.
+			if rest, _ := io.ReadAll(reader); len(bytes.TrimSpace(rest)) > 0 {
+				return fmt.Errorf("%w at offset %d: %v", errCorruptLog, good, err)
+			}
+			log.Printf("Discarding torn trailing WAL record at offset %d", good)
+			return f.Truncate(good)
+		}
+
+		s.books = applyOps(s.books, record.Ops)
+		s.pending++
+		good += int64(len(line))
+	}
+	return nil
+}
+
+func (s *LogStore) appendRecord(record logRecord) error {
+	line, err := encodeLogLine(record)
+	if err != nil {
+		return err
+	}
+	if _, err := s.logFile.Write(line); err != nil {
+		return err
+	}
+	return s.logFile.Sync()
+}
+
+// compact writes books as the new snapshot and empties the log. A crash
+// between the two steps is harmless because replaying puts and deletes over
+// the newer snapshot is idempotent.
+func (s *LogStore) compact(books []*models.Book) error {
+	data, err := s.codec.Marshal(books)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.snapshotPath, data); err != nil {
+		return err
+	}
+
+	s.books = books
+	s.pending = 0
+	return s.logFile.Truncate(0)
+}
+
+func encodeLogLine(record logRecord) ([]byte, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	line := make([]byte, 0, len(payload)+10)
+	line = append(line, fmt.Sprintf("%08x ", crc32.ChecksumIEEE(payload))...)
+	line = append(line, payload...)
+	return append(line, '\n'), nil
+}
+
+func decodeLogLine(line []byte) (logRecord, error) {
+	var record logRecord
+
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	if len(line) < 10 || line[8] != ' ' {
+		return record, errCorruptLog
+	}
+	sum, err := strconv.ParseUint(string(line[:8]), 16, 32)
+	if err != nil {
+		return record, errCorruptLog
+	}
+	payload := line[9:]
+	if crc32.ChecksumIEEE(payload) != uint32(sum) {
+		return record, errCorruptLog
+	}
+
+	err = json.Unmarshal(payload, &record)
+	return record, err
+}
+
+// diffBooks returns the operations that turn before into after.
+func diffBooks(before, after []*models.Book) []logOp {
+	old := make(map[string]*models.Book, len(before))
+	for _, book := range before {
+		old[book.BookID] = book
+	}
+
+	var ops []logOp
+	seen := make(map[string]bool, len(after))
+	for _, book := range after {
+		seen[book.BookID] = true
+		if prev, ok := old[book.BookID]; !ok || *prev != *book {
+			clone := *book
+			ops = append(ops, logOp{Op: opPut, Book: &clone})
+		}
+	}
+	for _, book := range before {
+		if !seen[book.BookID] {
+			ops = append(ops, logOp{Op: opDelete, ID: book.BookID})
+		}
+	}
+	return ops
+}
+
+// applyOps replaces books in place on put, appends unknown ones, and drops
+// deleted ones, so catalog order is insertion order.
+func applyOps(books []*models.Book, ops []logOp) []*models.Book {
+	for _, op := range ops {
+		switch op.Op {
+		case opPut:
+			replaced := false
+			for i, book := range books {
+				if book.BookID == op.Book.BookID {
+					books[i] = op.Book
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				books = append(books, op.Book)
+			}
+		case opDelete:
+			for i, book := range books {
+				if book.BookID == op.ID {
+					books = append(books[:i], books[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return books
+}
+
+func cloneBooks(books []*models.Book) []*models.Book {
+	if books == nil {
+		return nil
+	}
+	clones := make([]*models.Book, len(books))
+	for i, book := range books {
+		clone := *book
+		clones[i] = &clone
+	}
+	return clones
+}
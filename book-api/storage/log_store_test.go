@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"book-api/models"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendBook(t *testing.T, s *LogStore, book *models.Book) {
+	require.NoError(t, s.Update(func(books []*models.Book) ([]*models.Book, error) {
+		return append(books, book), nil
+	}))
+}
+
+func TestLogStoreReplaysAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+
+	s, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+	first, second := newTestBook("First"), newTestBook("Second")
+	appendBook(t, s, first)
+	appendBook(t, s, second)
+	require.NoError(t, s.Update(func(books []*models.Book) ([]*models.Book, error) {
+		books[1].Title = "Second (revised)"
+		return books[1:], nil
+	}))
+
+	// Simulate a crash: reopen without Close so only the log has the data.
+	reopened, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+	books, err := reopened.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, second.BookID, books[0].BookID)
+	assert.Equal(t, "Second (revised)", books[0].Title)
+	assert.NotEqual(t, first.BookID, books[0].BookID)
+}
+
+func TestLogStoreAppendsOnlyChangedBooks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	s, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		appendBook(t, s, newTestBook("Book"))
+	}
+	before, err := os.Stat(path + ".wal")
+	require.NoError(t, err)
+
+	appendBook(t, s, newTestBook("One more"))
+	after, err := os.Stat(path + ".wal")
+	require.NoError(t, err)
+
+	// One new record, not a rewrite of the whole catalog.
+	assert.Less(t, after.Size()-before.Size(), before.Size()/5)
+}
+
+func TestLogStoreToleratesTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	s, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+	appendBook(t, s, newTestBook("Durable"))
+
+	f, err := os.OpenFile(path+".wal", os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`1234abcd {"ops":[{"op":"put","book":{"bookId":"x"`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+	books, err := reopened.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Durable", books[0].Title)
+
+	// The torn bytes are gone, so new records land on a clean line.
+	appendBook(t, reopened, newTestBook("After crash"))
+	again, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+	books, err = again.ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, books, 2)
+}
+
+func TestLogStoreRejectsCorruptionBeforeTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	s, err := NewLogStore(path, JSONCodec{}, 100)
+	require.NoError(t, err)
+	appendBook(t, s, newTestBook("One"))
+	appendBook(t, s, newTestBook("Two"))
+
+	data, err := os.ReadFile(path + ".wal")
+	require.NoError(t, err)
+	data[0] ^= 0xff
+	require.NoError(t, os.WriteFile(path+".wal", data, 0644))
+
+	_, err = NewLogStore(path, JSONCodec{}, 100)
+	assert.ErrorIs(t, err, errCorruptLog)
+}
+
+func TestLogStoreCompacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	s, err := NewLogStore(path, JSONCodec{}, 3)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		appendBook(t, s, newTestBook("Book"))
+	}
+
+	info, err := os.Stat(path + ".wal")
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	snapshot, err := os.ReadFile(path)
+	require.NoError(t, err)
+	books, err := JSONCodec{}.Unmarshal(snapshot)
+	require.NoError(t, err)
+	assert.Len(t, books, 3)
+
+	appendBook(t, s, newTestBook("Logged"))
+	require.NoError(t, s.Close())
+	reopened, err := NewLogStore(path, JSONCodec{}, 3)
+	require.NoError(t, err)
+	books, err = reopened.ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, books, 4)
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"book-api/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ReloadStatus describes what happened the last time the data file was found
+// to have been changed by someone other than this store.
+type ReloadStatus struct {
+	WatchInterval string     `json:"watchInterval,omitempty"`
+	LastChecked   time.Time  `json:"lastChecked"`
+	LastReload    *time.Time `json:"lastReload,omitempty"`
+	LastRejected  *time.Time `json:"lastRejected,omitempty"`
+	LastError     string     `json:"lastError,omitempty"`
+	Reloads       int        `json:"reloads"`
+	Rejections    int        `json:"rejections"`
+	BookCount     int        `json:"bookCount"`
+}
+
+var ErrInvalidCatalog = errors.New("invalid catalog")
+
+// validateCatalog checks externally supplied content before it replaces the
+// catalog: every book must pass Validate and IDs and ISBNs must be unique.
+func validateCatalog(books []*models.Book) error {
+	var errs []string
+	ids := make(map[string]bool, len(books))
+	isbns := make(map[string]bool, len(books))
+
+	for i, book := range books {
+		if book == nil {
+			errs = append(errs, fmt.Sprintf("book %d: null entry", i+1))
+			continue
+		}
+		if book.BookID == "" {
+			errs = append(errs, fmt.Sprintf("book %d: bookId is required", i+1))
+		} else if ids[book.BookID] {
+			errs = append(errs, fmt.Sprintf("book %d: duplicate bookId %s", i+1, book.BookID))
+		}
+		if isbns[book.ISBN] {
+			errs = append(errs, fmt.Sprintf("book %d: duplicate isbn %s", i+1, book.ISBN))
+		}
+		if err := book.Validate(); err != nil {
+			errs = append(errs, fmt.Sprintf("book %d (%s): %v", i+1, book.BookID, err))
+		}
+		ids[book.BookID] = true
+		isbns[book.ISBN] = true
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidCatalog, strings.Join(errs, "; "))
+	}
+	return nil
+}
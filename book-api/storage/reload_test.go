@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"book-api/models"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// editExternally rewrites the data file the way an operator's editor would and
+// moves its mtime forward so the change is visible even on coarse clocks.
+func editExternally(t *testing.T, path string, data []byte) {
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+}
+
+func TestFileStoreRejectsInvalidExternalEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	store.AcceptHandEdits(true)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Good")}))
+
+	invalid := newTestBook("")
+	data, err := JSONCodec{}.Marshal([]*models.Book{invalid})
+	require.NoError(t, err)
+	editExternally(t, path, data)
+
+	books, err := store.ReadAll()
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Good", books[0].Title)
+
+	status := store.ReloadStatus()
+	assert.Equal(t, 1, status.Rejections)
+	assert.Contains(t, status.LastError, "title is required")
+}
+
+func TestFileStoreWatchNotifiesListeners(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "books.json")
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+	store.AcceptHandEdits(true)
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Before")}))
+
+	reloaded := make(chan []*models.Book, 1)
+	store.OnReload(func(books []*models.Book) { reloaded <- books })
+	stop := store.Watch(10 * time.Millisecond)
+	defer stop()
+
+	// Our own writes are not reported as reloads.
+	require.NoError(t, store.WriteAll([]*models.Book{newTestBook("Own write")}))
+
+	data, err := JSONCodec{}.Marshal([]*models.Book{newTestBook("After"), newTestBook("Added")})
+	require.NoError(t, err)
+	editExternally(t, path, data)
+
+	select {
+	case books := <-reloaded:
+		require.Len(t, books, 2)
+		assert.Equal(t, "After", books[0].Title)
+	case <-time.After(2 * time.Second):
+		t.Fatal("external edit was not picked up")
+	}
+
+	status := store.ReloadStatus()
+	assert.Equal(t, 1, status.Reloads)
+	assert.Equal(t, 2, status.BookCount)
+	assert.Empty(t, status.LastError)
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"book-api/models"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+var (
+	ErrUnsupportedSchema = errors.New("unsupported schema version")
+	ErrMigrationFailed   = errors.New("schema migration failed")
+)
+
+// Migration upgrades the books of a data file from Version-1 to Version. It
+// works on the decoded JSON objects rather than models.Book so it can read
+// fields the current struct no longer has.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(books []map[string]interface{}) ([]map[string]interface{}, error)
+}
+
+// migrations is the ordered registry of upgrades; a file written with schema
+// version N has migrations[N:] applied when it is loaded. Versions must be
+// consecutive starting at 1. Append new migrations, never edit old ones.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "wrap the bare books array in a versioned envelope",
+		Up: func(books []map[string]interface{}) ([]map[string]interface{}, error) {
+			return books, nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "start every book's version counter at 1",
+		Up: func(books []map[string]interface{}) ([]map[string]interface{}, error) {
+			for _, book := range books {
+				// Gob files are decoded into models.Book before migrating,
+				// so their books arrive with a version of 0 rather than none.
+				if v, ok := book["version"].(float64); !ok || v <= 0 {
+					book["version"] = 1
+				}
+			}
+			return books, nil
+		},
+	},
+}
+
+// SchemaVersion is the version this build writes.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// fileEnvelope is the persisted layout of the JSON and gob formats. Files
+// written before it existed hold the bare books array and are version 0.
+type fileEnvelope struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Books         []*models.Book `json:"books"`
+}
+
+type rawEnvelope struct {
+	SchemaVersion *int              `json:"schemaVersion"`
+	Books         []json.RawMessage `json:"books"`
+}
+
+// upgradeBooks decodes records written with schema version, running every
+// migration newer than version first.
+func upgradeBooks(version int, records []json.RawMessage) ([]*models.Book, error) {
+	if version < 0 || version > SchemaVersion() {
+		return nil, fmt.Errorf("%w: file has version %d, this build supports up to %d",
+			ErrUnsupportedSchema, version, SchemaVersion())
+	}
+
+	if version < SchemaVersion() {
+		docs := make([]map[string]interface{}, len(records))
+		for i, record := range records {
+			if err := json.Unmarshal(record, &docs[i]); err != nil {
+				return nil, fmt.Errorf("book %d: %w", i+1, err)
+			}
+		}
+
+		for _, m := range migrations[version:] {
+			var err error
+			if docs, err = m.Up(docs); err != nil {
+				return nil, fmt.Errorf("%w: to version %d (%s): %v", ErrMigrationFailed, m.Version, m.Description, err)
+			}
+		}
+
+		records = make([]json.RawMessage, len(docs))
+		for i, doc := range docs {
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return nil, fmt.Errorf("%w: to version %d: %v", ErrMigrationFailed, SchemaVersion(), err)
+			}
+			records[i] = data
+		}
+	}
+
+	var books []*models.Book
+	for i, record := range records {
+		var book *models.Book
+		if err := json.Unmarshal(record, &book); err != nil {
+			return nil, fmt.Errorf("book %d: %w", i+1, err)
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
+// booksToRecords lets formats that decode straight into models.Book, like gob,
+// go through the JSON-based migrations.
+func booksToRecords(books []*models.Book) ([]json.RawMessage, error) {
+	records := make([]json.RawMessage, len(books))
+	for i, book := range books {
+		data, err := json.Marshal(book)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = data
+	}
+	return records, nil
+}
+
+// MigrateSchema rewrites a data file written with an older schema version in
+// the current one and returns the version it found. The old file is saved
+// first: into the backups when they are enabled, otherwise next to the data
+// file as "<file>.schema-v<N>.bak". Reads migrate old files on the fly, so
+// this only makes the upgrade permanent.
+func (fs *FileStore) MigrateSchema() (int, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	unlock, err := lockPath(fs.lockPath, true)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	books, _, err := fs.readOrRecover()
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(fs.filePath)
+	if os.IsNotExist(err) || (err == nil && len(bytes.TrimSpace(data)) == 0) {
+		return SchemaVersion(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := fs.codec.DetectVersion(data)
+	if err != nil || version >= SchemaVersion() {
+		return version, err
+	}
+
+	if fs.backups != nil {
+		err = fs.backups.Save(data)
+	} else {
+		err = writeFileAtomic(fmt.Sprintf("%s.schema-v%d.bak", fs.filePath, version), data)
+	}
+	if err != nil {
+		return version, fmt.Errorf("backup before schema migration failed: %w", err)
+	}
+
+	if err := fs.writeFile(books); err != nil {
+		return version, err
+	}
+	log.Printf("Migrated %s from schema version %d to %d", fs.filePath, version, SchemaVersion())
+	return version, nil
+}
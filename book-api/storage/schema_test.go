@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"book-api/models"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationsAreConsecutive(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, m.Description)
+		assert.NotNil(t, m.Up, m.Description)
+	}
+}
+
+func TestCodecsReadUnversionedFilesAsVersionZero(t *testing.T) {
+	books := []*models.Book{newTestBook("Old"), newTestBook("Older")}
+
+	bare, err := json.Marshal(books)
+	require.NoError(t, err)
+	var ndjson bytes.Buffer
+	for _, book := range books {
+		require.NoError(t, json.NewEncoder(&ndjson).Encode(book))
+	}
+	var gobData bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&gobData).Encode(books))
+
+	for name, tc := range map[string]struct {
+		codec Codec
+		data  []byte
+	}{
+		"json":   {JSONCodec{}, bare},
+		"ndjson": {NDJSONCodec{}, ndjson.Bytes()},
+		"gob":    {GobCodec{}, gobData.Bytes()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			version, err := tc.codec.DetectVersion(tc.data)
+			require.NoError(t, err)
+			assert.Equal(t, 0, version)
+
+			got, err := tc.codec.Unmarshal(tc.data)
+			require.NoError(t, err)
+			require.Len(t, got, 2)
+			assert.Equal(t, "Old", got[0].Title)
+
+			current, err := tc.codec.Marshal(got)
+			require.NoError(t, err)
+			version, err = tc.codec.DetectVersion(current)
+			require.NoError(t, err)
+			assert.Equal(t, SchemaVersion(), version)
+		})
+	}
+}
+
+func TestMigrationStartsVersionCounters(t *testing.T) {
+	books, err := JSONCodec{}.Unmarshal([]byte(`[{"bookId": "1"}, {"bookId": "2", "version": 5}]`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), books[0].Version)
+	assert.Equal(t, int64(5), books[1].Version)
+}
+
+func TestMigrationStartsGobVersionCounters(t *testing.T) {
+	// A book as version 0 files stored it, before books had a version.
+	type legacyBook struct {
+		BookID string
+		Title  string
+	}
+	var data bytes.Buffer
+	require.NoError(t, gob.NewEncoder(&data).Encode([]*legacyBook{{"1", "Old"}}))
+
+	books, err := GobCodec{}.Unmarshal(data.Bytes())
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Old", books[0].Title)
+	assert.Equal(t, int64(1), books[0].Version)
+
+	books, err = JSONCodec{}.Unmarshal([]byte(`[{"bookId": "1", "version": 0}, {"bookId": "2", "version": -3}, {"bookId": "3", "version": null}]`))
+	require.NoError(t, err)
+	for _, book := range books {
+		assert.Equal(t, int64(1), book.Version, book.BookID)
+	}
+}
+
+func TestCodecsRejectNewerSchema(t *testing.T) {
+	_, err := JSONCodec{}.Unmarshal([]byte(`{"schemaVersion": 99, "books": []}`))
+	assert.ErrorIs(t, err, ErrUnsupportedSchema)
+
+	_, err = NDJSONCodec{}.Unmarshal([]byte("{\"schemaVersion\": 99}\n"))
+	assert.ErrorIs(t, err, ErrUnsupportedSchema)
+}
+
+func TestMigrationsRunInOrder(t *testing.T) {
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	migrations = append(append([]Migration{}, saved...),
+		Migration{
+			Version:     len(saved) + 1,
+			Description: "rename name to title",
+			Up: func(books []map[string]interface{}) ([]map[string]interface{}, error) {
+				for _, book := range books {
+					book["title"] = book["name"]
+					delete(book, "name")
+				}
+				return books, nil
+			},
+		},
+		Migration{
+			Version:     len(saved) + 2,
+			Description: "append ! to titles",
+			Up: func(books []map[string]interface{}) ([]map[string]interface{}, error) {
+				for _, book := range books {
+					book["title"] = book["title"].(string) + "!"
+				}
+				return books, nil
+			},
+		},
+	)
+
+	books, err := JSONCodec{}.Unmarshal([]byte(`[{"bookId": "1", "name": "Renamed"}]`))
+	require.NoError(t, err)
+	require.Len(t, books, 1)
+	assert.Equal(t, "Renamed!", books[0].Title)
+
+	// Only the migrations newer than the file's version run.
+	data := fmt.Sprintf(`{"schemaVersion": %d, "books": [{"bookId": "1", "title": "Kept"}]}`, len(saved)+1)
+	books, err = JSONCodec{}.Unmarshal([]byte(data))
+	require.NoError(t, err)
+	assert.Equal(t, "Kept!", books[0].Title)
+}
+
+func TestFileStoreMigrateSchema(t *testing.T) {
+	t.Run("with backups", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "books.json")
+		old, err := json.Marshal([]*models.Book{newTestBook("Legacy")})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, old, 0644))
+
+		store, err := NewFileStore(path, JSONCodec{})
+		require.NoError(t, err)
+		backups, err := NewBackups(filepath.Join(dir, "backups"), path, 5, 0)
+		require.NoError(t, err)
+		store.EnableBackups(backups)
+
+		from, err := store.MigrateSchema()
+		require.NoError(t, err)
+		assert.Equal(t, 0, from)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		version, err := JSONCodec{}.DetectVersion(data)
+		require.NoError(t, err)
+		assert.Equal(t, SchemaVersion(), version)
+
+		list, err := backups.List()
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		saved, err := backups.Read(list[0].Name)
+		require.NoError(t, err)
+		assert.Equal(t, old, saved)
+
+		// Already current: nothing is rewritten or backed up.
+		from, err = store.MigrateSchema()
+		require.NoError(t, err)
+		assert.Equal(t, SchemaVersion(), from)
+		list, err = backups.List()
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+
+		books, err := store.ReadAll()
+		require.NoError(t, err)
+		assert.Equal(t, "Legacy", books[0].Title)
+	})
+
+	t.Run("without backups", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "books.ndjson")
+		old, err := json.Marshal(newTestBook("Legacy"))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(path, append(old, '\n'), 0644))
+
+		store, err := NewFileStore(path, NDJSONCodec{})
+		require.NoError(t, err)
+		_, err = store.MigrateSchema()
+		require.NoError(t, err)
+
+		saved, err := os.ReadFile(path + ".schema-v0.bak")
+		require.NoError(t, err)
+		assert.Equal(t, append(old, '\n'), saved)
+	})
+}
+
+func TestFileStoreLeavesNewerSchemaAlone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "books.json")
+	newer := []byte(`{"schemaVersion": 99, "books": []}`)
+	require.NoError(t, os.WriteFile(path, newer, 0644))
+
+	store, err := NewFileStore(path, JSONCodec{})
+	require.NoError(t, err)
+
+	_, err = store.ReadAll()
+	assert.ErrorIs(t, err, ErrUnsupportedSchema)
+	_, err = store.MigrateSchema()
+	assert.ErrorIs(t, err, ErrUnsupportedSchema)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, newer, data)
+	assert.Empty(t, quarantinedFiles(t, dir))
+}
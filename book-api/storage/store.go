@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"book-api/models"
+	"os"
+	"time"
+)
+
+// Store persists the whole book catalog. Implementations must make Update
+// atomic with respect to every other call on the same store. Modified reports
+// when the catalog last changed, deletions included; it may be later than the
+// last change but never earlier.
+type Store interface {
+	ReadAll() ([]*models.Book, error)
+	WriteAll(books []*models.Book) error
+	Update(fn func(books []*models.Book) ([]*models.Book, error)) error
+	Modified() (time.Time, error)
+}
+
+// latestModTime returns the newest modification time of the files at paths,
+// skipping those that do not exist.
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}